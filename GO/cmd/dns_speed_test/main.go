@@ -0,0 +1,833 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/history"
+	"dns_speed_test/metrics"
+	"dns_speed_test/monitor"
+	"dns_speed_test/server"
+	"dns_speed_test/settings"
+)
+
+const usage = `Usage: dns_speed_test [command] [flags]
+
+Commands:
+  run             benchmark DNS providers (the default)
+  monitor         benchmark on a schedule and alert when a provider degrades
+  serve           serve a web dashboard and JSON API for running benchmarks
+  list-providers  list the built-in and custom providers
+  history         list the runs saved by the GUI, "run" and "monitor"
+  export          write a saved run as JSON, NDJSON or CSV
+
+Run "dns_speed_test <command> -h" for the flags of a command.
+`
+
+func main() {
+	args := os.Args[1:]
+	cmd := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "run":
+		err = runCmd(args)
+	case "monitor":
+		err = monitorCmd(args)
+	case "serve":
+		err = serveCmd(args)
+	case "list-providers":
+		err = listProvidersCmd(args)
+	case "history":
+		err = historyCmd(args)
+	case "export":
+		err = exportCmd(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "dns_speed_test: unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dns_speed_test:", err)
+		os.Exit(1)
+	}
+}
+
+// parseFlags parses args into fs, exiting on -h or a bad flag the way the
+// flag package's default set does.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "%s: unexpected argument %q\n", fs.Name(), fs.Arg(0))
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// defaultDomains are the domains the command line tests when given none.
+// They are the five it has always tested, rather than the GUI's longer
+// dnsbench.DefaultDomains, so that its results stay comparable with those
+// of earlier versions.
+var defaultDomains = []string{
+	"www.google.com",
+	"www.amazon.com",
+	"www.microsoft.com",
+	"www.facebook.com",
+	"www.netflix.com",
+}
+
+// benchFlags are the flags that choose the providers and configure a
+// benchmark, shared by "run" and "monitor".
+type benchFlags struct {
+	providerList, domainList, domainFile, domainSet *string
+	domainLimit                                     *int
+	protocol                                        *string
+	family, count                                   *int
+	timeout                                         *time.Duration
+	concurrency                                     *int
+	queryType                                       *string
+	uncached                                        *bool
+	zone, clientSubnet                              *string
+	check, dnssec, identify, dohPost, doqReconnect  *bool
+}
+
+func addBenchFlags(fs *flag.FlagSet) *benchFlags {
+	return &benchFlags{
+		providerList: fs.String("providers", "", "comma-separated provider names or addresses (IP, IP:port or DoH URL); the built-in and enabled custom providers if empty"),
+		domainList:   fs.String("domains", "", "comma-separated domains to query; the built-in list if empty"),
+		domainFile:   fs.String("domain-file", "", "file of domains to query, one per line or a top-sites CSV; record types may follow a domain, as in \"example.com MX TXT\""),
+		domainSet:    fs.String("domain-set", "", "named domain set from the GUI settings to query"),
+		domainLimit:  fs.Int("domain-limit", 0, "query at most this many domains from -domain-file; 0 means all"),
+		protocol:     fs.String("protocol", "", "udp, tcp, dot, doq or doh; by default DoH providers use DoH and the rest UDP"),
+		family:       fs.Int("family", 4, "IP family to reach providers over, 4 or 6"),
+		count:        fs.Int("count", 3, "queries per domain"),
+		timeout:      fs.Duration("timeout", 5*time.Second, "timeout per query"),
+		concurrency:  fs.Int("concurrency", 0, "queries in flight per provider; 1 sends them one at a time, 0 means no limit"),
+		queryType:    fs.String("type", "A", "comma-separated record types to query: "+strings.Join(dnsbench.QueryTypes, ", ")),
+		uncached:     fs.Bool("uncached", false, "also query random names to measure uncached resolution"),
+		zone:         fs.String("zone", "", "zone for uncached names; under each test domain if empty"),
+		check:        fs.Bool("check", true, "check answers for hijacking and NXDOMAIN redirection"),
+		dnssec:       fs.Bool("dnssec", false, "check whether each provider validates DNSSEC"),
+		identify:     fs.Bool("identify", false, "ask each provider which server answered (NSID, id.server, hostname.bind)"),
+		clientSubnet: fs.String("ecs", "", "send this client subnet with every query (EDNS Client Subnet), such as 198.51.100.0/24, and compare the providers' answers"),
+		dohPost:      fs.Bool("doh-post", false, "send DoH queries with POST instead of GET"),
+		doqReconnect: fs.Bool("doq-reconnect", false, "open a new DoQ connection per query to measure 0-RTT"),
+	}
+}
+
+// setup turns the flags into the providers to test and the configuration
+// to test them with.
+func (f *benchFlags) setup() ([]dnsbench.DNSProvider, dnsbench.TestConfig, error) {
+	config := dnsbench.TestConfig{
+		TestsPerDomain:   *f.count,
+		Timeout:          *f.timeout,
+		ParallelTests:    *f.concurrency != 1,
+		Concurrency:      *f.concurrency,
+		UncachedTests:    *f.uncached,
+		UncachedZone:     *f.zone,
+		CheckAnswers:     *f.check,
+		CheckDNSSEC:      *f.dnssec,
+		ClientSubnet:     *f.clientSubnet,
+		IdentifyResolver: *f.identify,
+		DoQReconnect:     *f.doqReconnect,
+	}
+	if *f.dohPost {
+		config.DoHMethod = http.MethodPost
+	}
+	switch *f.protocol {
+	case "", "udp", "doh":
+	case "tcp":
+		config.UseTCP = true
+	case "dot":
+		config.UseTLS = true
+	case "doq":
+		config.UseQUIC = true
+	default:
+		return nil, config, fmt.Errorf("unknown protocol %q", *f.protocol)
+	}
+	switch *f.family {
+	case 4:
+	case 6:
+		config.UseIPv6 = true
+	default:
+		return nil, config, fmt.Errorf("IP family must be 4 or 6, not %d", *f.family)
+	}
+	if *f.count < 1 {
+		return nil, config, fmt.Errorf("count must be at least 1")
+	}
+	types := splitList(strings.ToUpper(*f.queryType))
+	for _, t := range types {
+		if !dnsbench.ValidQueryType(t) {
+			return nil, config, fmt.Errorf("unknown record type %q", t)
+		}
+	}
+	if len(types) > 0 {
+		config.QueryType = types[0]
+	}
+	if config.ClientSubnet != "" {
+		if _, err := dnsbench.ParseSubnet(config.ClientSubnet); err != nil {
+			return nil, config, err
+		}
+	}
+
+	s, err := settings.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dns_speed_test: settings not loaded:", err)
+	}
+	switch {
+	case *f.domainList != "":
+		config.Domains = splitList(*f.domainList)
+	case *f.domainFile != "":
+		file, err := os.Open(*f.domainFile)
+		if err != nil {
+			return nil, config, err
+		}
+		config.Domains, config.DomainTypes, err = dnsbench.ReadDomainTypes(file, *f.domainLimit)
+		file.Close()
+		if err != nil {
+			return nil, config, err
+		}
+		if len(config.Domains) == 0 {
+			return nil, config, fmt.Errorf("no domains in %s", *f.domainFile)
+		}
+	case *f.domainSet != "":
+		set, ok := s.FindDomainSet(*f.domainSet)
+		if !ok {
+			return nil, config, fmt.Errorf("unknown domain set %q", *f.domainSet)
+		}
+		config.Domains = set.Domains
+		config.DomainTypes = set.Types
+	default:
+		config.Domains = defaultDomains
+	}
+	if len(types) > 1 {
+		// Every domain without types of its own gets them all.
+		domainTypes := make(map[string][]string)
+		for _, domain := range config.Domains {
+			domainTypes[domain] = types
+		}
+		for domain, t := range config.DomainTypes {
+			domainTypes[domain] = t
+		}
+		config.DomainTypes = domainTypes
+	}
+
+	providers, err := selectProviders(s, *f.providerList, *f.protocol, *f.family)
+	if err != nil {
+		return nil, config, err
+	}
+	if len(providers) == 0 {
+		return nil, config, fmt.Errorf("no providers support protocol %q over IPv%d", *f.protocol, *f.family)
+	}
+	return providers, config, nil
+}
+
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	bench := addBenchFlags(fs)
+	format := fs.String("format", "table", "output format: table, json, ndjson or csv")
+	save := fs.Bool("save", true, "add the run to the saved history")
+	parseFlags(fs, args)
+
+	if !validFormat(*format, "table") {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	providers, config, err := bench.setup()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report := dnsbench.Report{StartedAt: time.Now(), Config: config}
+	report.Results = dnsbench.Run(ctx, providers, config, nil)
+	dnsbench.SortByLatency(report.Results)
+
+	if *format == "table" {
+		printTable(os.Stdout, report.Results)
+		if config.ClientSubnet != "" {
+			printAnswerGroups(os.Stdout, report.Results)
+		}
+	} else if err := dnsbench.Export(os.Stdout, report, *format); err != nil {
+		return err
+	}
+
+	if *save {
+		if err := saveRun(report); err != nil {
+			fmt.Fprintln(os.Stderr, "dns_speed_test: run not saved:", err)
+		}
+	}
+
+	for _, r := range report.Results {
+		if r.Success {
+			return nil
+		}
+	}
+	return errors.New("no provider answered")
+}
+
+func monitorCmd(args []string) error {
+	fs := flag.NewFlagSet("monitor", flag.ContinueOnError)
+	bench := addBenchFlags(fs)
+	scheduleFlag := fs.String("schedule", "5m", `interval between runs, such as "5m", or a cron expression such as "*/15 8-18 * * 1-5"`)
+	defaults := monitor.DefaultThresholds()
+	window := fs.Int("window", defaults.Window, "number of recent healthy runs the baseline is taken from")
+	minRuns := fs.Int("min-runs", defaults.MinRuns, "runs needed before alerting")
+	latencyFactor := fs.Float64("latency-factor", defaults.LatencyFactor, "alert when the median latency reaches this multiple of the baseline")
+	latencyMargin := fs.Duration("latency-margin", defaults.LatencyMargin, "and is at least this much slower than it")
+	lossPoints := fs.Float64("loss", defaults.LossPoints, "alert when the share of failed queries rises this many percentage points above the baseline")
+	desktop := fs.Bool("notify", false, "also show alerts as desktop notifications")
+	webhook := fs.String("webhook", "", "URL to POST each alert to as JSON")
+	save := fs.Bool("save", true, "add every run to the saved history")
+	metricsAddr := fs.String("metrics", "", "serve Prometheus metrics at /metrics on this address, such as :9153")
+	parseFlags(fs, args)
+
+	schedule, err := monitor.ParseSchedule(*scheduleFlag)
+	if err != nil {
+		return err
+	}
+	if *window < 1 || *minRuns < 1 || *minRuns > *window {
+		return fmt.Errorf("-min-runs must be between 1 and -window")
+	}
+	providers, config, err := bench.setup()
+	if err != nil {
+		return err
+	}
+
+	m := &monitor.Monitor{
+		Providers: providers,
+		Config:    config,
+		Schedule:  schedule,
+		Detector: monitor.NewDetector(monitor.Thresholds{
+			Window:        *window,
+			MinRuns:       *minRuns,
+			LatencyFactor: *latencyFactor,
+			LatencyMargin: *latencyMargin,
+			LossPoints:    *lossPoints,
+		}),
+		Notifiers: []monitor.Notifier{monitor.WriterNotifier{W: os.Stdout}},
+		OnError: func(err error) {
+			fmt.Fprintln(os.Stderr, "dns_speed_test: alert not sent:", err)
+		},
+	}
+	if *desktop {
+		m.Notifiers = append(m.Notifiers, monitor.Desktop{})
+	}
+	if *webhook != "" {
+		m.Notifiers = append(m.Notifiers, monitor.Webhook{URL: *webhook})
+	}
+	var registry *metrics.Registry
+	if *metricsAddr != "" {
+		registry = metrics.New()
+		m.OnQuery = registry.ObserveQuery
+		ln, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry)
+		srv := &http.Server{Handler: mux}
+		go srv.Serve(ln)
+		defer srv.Close()
+		fmt.Printf("Serving metrics on http://%s/metrics\n", ln.Addr())
+	}
+	m.OnReport = func(report dnsbench.Report, alerts []monitor.Alert) {
+		rolling := m.Detector.Rolling()
+		if registry != nil {
+			registry.ObserveRun(report)
+			for _, r := range rolling {
+				registry.SetDegraded(r.Provider, r.Degraded)
+			}
+		}
+		printSummary(os.Stdout, report, rolling)
+		if *save {
+			if err := saveRun(report); err != nil {
+				fmt.Fprintln(os.Stderr, "dns_speed_test: run not saved:", err)
+			}
+		}
+	}
+
+	fmt.Printf("Monitoring %d providers %v; press Ctrl-C to stop.\n", len(providers), schedule)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := m.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+func serveCmd(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("listen", "localhost:8053", "address to serve the dashboard and API on; the API has no authentication, so keep it local or behind a proxy")
+	hosts := fs.String("host", "", "comma-separated host names, besides localhost and the one in -listen, the dashboard may be opened under")
+	parseFlags(fs, args)
+
+	s, err := settings.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dns_speed_test: settings not loaded:", err)
+	}
+	srv := &server.Server{
+		Providers: s.AllProviders(),
+		Config:    s.Config(),
+		Retention: s.Retention,
+		Metrics:   metrics.New(),
+		Hosts:     splitList(*hosts),
+	}
+	if host, _, err := net.SplitHostPort(*addr); err == nil && host != "" {
+		srv.Hosts = append(srv.Hosts, host)
+	}
+	if srv.Store, err = history.Load(&s); err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Serving the dashboard on http://%s/\n", ln.Addr())
+	hs := &http.Server{Handler: srv}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		hs.Close()
+	}()
+	if err := hs.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// printSummary writes one line per run with each provider's median and
+// loss, marking the degraded ones.
+func printSummary(w io.Writer, report dnsbench.Report, rolling []monitor.Rolling) {
+	degraded := make(map[string]bool)
+	for _, r := range rolling {
+		degraded[r.Provider] = r.Degraded
+	}
+	var b strings.Builder
+	b.WriteString(report.StartedAt.Format("2006-01-02 15:04:05"))
+	for _, r := range report.Results {
+		median := "-"
+		if r.Success {
+			median = ms(r.Median)
+		}
+		mark := ""
+		if degraded[r.Provider.Name] {
+			mark = "!"
+		}
+		fmt.Fprintf(&b, "  %s%s %s/%.0f%%", r.Provider.Name, mark, median, r.Loss)
+	}
+	fmt.Fprintln(w, b.String())
+}
+
+// saveRun adds report to the history store and prunes it to the retention
+// in the settings.
+func saveRun(report dnsbench.Report) error {
+	s, err := settings.Load()
+	if err != nil {
+		return err
+	}
+	store, err := history.Load(&s)
+	if err != nil {
+		return err
+	}
+	if err := store.Add(report); err != nil {
+		return err
+	}
+	_, err = store.Prune(s.Retention, time.Now())
+	return err
+}
+
+// loadHistory opens the history store, first moving in any runs left in
+// the settings by older versions.
+func loadHistory() (*history.Store, error) {
+	s, err := settings.Load()
+	if err != nil {
+		return nil, err
+	}
+	return history.Load(&s)
+}
+
+// selectProviders resolves the -providers list, keeping only providers
+// that can be reached with protocol over the IP family. An empty list means
+// the built-in and enabled custom providers.
+func selectProviders(s settings.Settings, list, protocol string, family int) ([]dnsbench.DNSProvider, error) {
+	var providers []dnsbench.DNSProvider
+	names := splitList(list)
+	if len(names) == 0 {
+		providers = s.AllProviders()
+	}
+	known := append([]dnsbench.DNSProvider(nil), dnsbench.DefaultProviders...)
+	for _, p := range s.Providers {
+		known = append(known, p.DNSProvider)
+	}
+	for _, name := range names {
+		p, err := parseProvider(name, known)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+
+	var selected []dnsbench.DNSProvider
+	for _, p := range providers {
+		own := p.Transport
+		if p.URL != "" {
+			own = dnsbench.TransportDoH
+		}
+		switch {
+		case protocol == "doh" && own != dnsbench.TransportDoH:
+		case protocol != "" && protocol != "doh" && own != "" && string(own) != protocol:
+		case family == 6 && p.URL == "" && p.IPv6 == "":
+		default:
+			selected = append(selected, p)
+		}
+	}
+	return selected, nil
+}
+
+// parseProvider finds a known provider by name, or makes one from an IP
+// address, IP:port or DoH URL.
+func parseProvider(s string, known []dnsbench.DNSProvider) (dnsbench.DNSProvider, error) {
+	for _, p := range known {
+		if strings.EqualFold(p.Name, s) {
+			return p, nil
+		}
+	}
+	if strings.HasPrefix(s, "https://") {
+		return dnsbench.DNSProvider{Name: s, URL: s}, nil
+	}
+
+	host, port := s, 0
+	if h, ps, err := net.SplitHostPort(s); err == nil {
+		n, err := strconv.Atoi(ps)
+		if err != nil || n < 1 || n > 65535 {
+			return dnsbench.DNSProvider{}, fmt.Errorf("invalid port in %q", s)
+		}
+		host, port = h, n
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return dnsbench.DNSProvider{}, fmt.Errorf("unknown provider %q", s)
+	}
+	p := dnsbench.DNSProvider{Name: s, IP: host, Port: port}
+	if ip.To4() == nil {
+		p.IP, p.IPv6 = "", host
+	}
+	return p, nil
+}
+
+func printTable(w io.Writer, results []dnsbench.TestResult) {
+	fmt.Fprintln(w, "\nDNS Provider Latency Results (across multiple domains):")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	columns := optionalColumns(results)
+	header := "Provider\tAddress\tMean\tMin\tMedian\tP90\tP95\tP99\tMax\tStdDev\tJitter\tLoss\t"
+	for _, c := range columns {
+		header += c.name + "\t"
+	}
+	fmt.Fprintln(tw, header)
+	for _, result := range results {
+		var optional string
+		for _, c := range columns {
+			if v := c.value(result); v != "" {
+				optional += v + "\t"
+			} else {
+				optional += "-\t"
+			}
+		}
+		if !result.Success {
+			fmt.Fprintf(tw, "%s\t%s\tTimeout or Error\t\t\t\t\t\t\t\t\t%.0f%%\t%s\n",
+				result.Provider.Name, result.Provider.Address(), result.Loss, optional)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%.0f%%\t%s\n",
+			result.Provider.Name, result.Provider.Address(), ms(result.Latency),
+			ms(result.Min), ms(result.Median), ms(result.P90), ms(result.P95), ms(result.P99),
+			ms(result.Max), ms(result.StdDev), ms(result.Jitter), result.Loss, optional)
+		for _, t := range dnsbench.QueryTypes {
+			s, ok := result.TypeStats[t]
+			if !ok {
+				continue
+			}
+			if s.Loss == 100 {
+				fmt.Fprintf(tw, "  %s\t\tTimeout or Error\t\t\t\t\t\t\t\t\t%.0f%%\t\n", t, s.Loss)
+				continue
+			}
+			fmt.Fprintf(tw, "  %s\t\t\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%.0f%%\t\n",
+				t, ms(s.Min), ms(s.Median), ms(s.P90), ms(s.P95), ms(s.P99),
+				ms(s.Max), ms(s.StdDev), ms(s.Jitter), s.Loss)
+		}
+	}
+	tw.Flush()
+
+	for _, result := range results {
+		for _, f := range result.Findings {
+			fmt.Fprintf(w, "WARNING: %s: %s\n", result.Provider.Name, f)
+		}
+	}
+}
+
+// optionalColumn is a column of the results table shown only when some
+// provider has a value for it.
+type optionalColumn struct {
+	name  string
+	value func(dnsbench.TestResult) string
+}
+
+// optionalColumns returns the columns with values in results.
+func optionalColumns(results []dnsbench.TestResult) []optionalColumn {
+	all := []optionalColumn{
+		{"Uncached", func(r dnsbench.TestResult) string {
+			switch {
+			case r.UncachedStats == (dnsbench.Stats{}):
+				return ""
+			case r.UncachedStats.Loss == 100:
+				return "Timeout or Error"
+			}
+			return ms(r.UncachedStats.Median)
+		}},
+		{"First Query", func(r dnsbench.TestResult) string { return msIfSet(r.FirstQueryLatency) }},
+		{"Reused", func(r dnsbench.TestResult) string { return msIfSet(r.ReusedLatency) }},
+		{"Handshake", func(r dnsbench.TestResult) string { return msIfSet(r.HandshakeLatency) }},
+		{"0-RTT", func(r dnsbench.TestResult) string { return msIfSet(r.ZeroRTTLatency) }},
+		{"1-RTT", func(r dnsbench.TestResult) string { return msIfSet(r.OneRTTLatency) }},
+		{"DNSSEC", func(r dnsbench.TestResult) string {
+			if r.DNSSEC == nil {
+				return ""
+			}
+			return r.DNSSEC.String()
+		}},
+		{"ECS", func(r dnsbench.TestResult) string {
+			if r.ECS == nil {
+				return ""
+			}
+			return r.ECS.String()
+		}},
+		{"Instance", func(r dnsbench.TestResult) string {
+			if r.Identity == nil {
+				return ""
+			}
+			return r.Identity.Instance()
+		}},
+	}
+	var columns []optionalColumn
+	for _, c := range all {
+		for _, r := range results {
+			if c.value(r) != "" {
+				columns = append(columns, c)
+				break
+			}
+		}
+	}
+	return columns
+}
+
+// printAnswerGroups lists, for every domain the providers did not agree
+// on, which of them returned addresses in which networks.
+func printAnswerGroups(w io.Writer, results []dnsbench.TestResult) {
+	var differing []dnsbench.DomainAnswers
+	for _, d := range dnsbench.CompareAnswers(results) {
+		if len(d.Groups) > 1 {
+			differing = append(differing, d)
+		}
+	}
+	if len(differing) == 0 {
+		fmt.Fprintln(w, "\nEvery provider returned addresses in the same networks.")
+		return
+	}
+	fmt.Fprintln(w, "\nAnswers that differ between providers:")
+	for _, d := range differing {
+		fmt.Fprintf(w, "%s\n", d.Domain)
+		for _, g := range d.Groups {
+			fmt.Fprintf(w, "  %s: %s\n", strings.Join(g.Providers, ", "), strings.Join(g.Networks, " "))
+		}
+	}
+}
+
+func listProvidersCmd(args []string) error {
+	fs := flag.NewFlagSet("list-providers", flag.ContinueOnError)
+	format := fs.String("format", "table", "output format: table or json")
+	parseFlags(fs, args)
+
+	s, err := settings.Load()
+	if err != nil {
+		return err
+	}
+	providers := []settings.Provider{}
+	for _, p := range dnsbench.DefaultProviders {
+		providers = append(providers, settings.Provider{DNSProvider: p, Group: settings.BuiltinGroup, Enabled: true})
+	}
+	providers = append(providers, s.Providers...)
+
+	switch *format {
+	case "table":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "Name\tGroup\tIPv4\tIPv6\tPort\tTransport\tTLS Name / DoH URL\tEnabled\t")
+		for _, p := range providers {
+			port := ""
+			if p.Port != 0 {
+				port = strconv.Itoa(p.Port)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%v\t\n",
+				p.Name, p.Group, p.IP, p.IPv6, port, p.Transport, p.ServerName+p.URL, p.Enabled)
+		}
+		return tw.Flush()
+	case "json":
+		return writeJSON(os.Stdout, providers)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+func historyCmd(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	format := fs.String("format", "table", "output format: table or json")
+	since := fs.String("since", "", "only runs started after this date (2006-01-02) or this long ago (e.g. 24h)")
+	provider := fs.String("provider", "", "only runs that tested this provider")
+	domain := fs.String("domain", "", "only runs that queried this domain")
+	queryType := fs.String("type", "", "only runs that queried this record type")
+	protocol := fs.String("protocol", "", "only runs that sent queries over udp, tcp, dot, doq or doh")
+	parseFlags(fs, args)
+
+	q := history.Query{
+		Provider:  *provider,
+		Domain:    *domain,
+		QueryType: *queryType,
+		Transport: dnsbench.Transport(*protocol),
+	}
+	if *since != "" {
+		if d, err := time.ParseDuration(*since); err == nil {
+			q.Since = time.Now().Add(-d)
+		} else if t, err := time.ParseInLocation("2006-01-02", *since, time.Local); err == nil {
+			q.Since = t
+		} else {
+			return fmt.Errorf("-since %q is neither a date nor a duration", *since)
+		}
+	}
+	store, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	all := store.Runs()
+	switch *format {
+	case "table":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "Run\tStarted\tProviders\tFastest\tLatency\t")
+		for i := len(all) - 1; i >= 0; i-- {
+			report := all[i]
+			if !q.Match(report) {
+				continue
+			}
+			fastest, latency := "-", "-"
+			for _, r := range report.Results {
+				if r.Success {
+					fastest, latency = r.Provider.Name, ms(r.Latency)
+					break
+				}
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t\n", len(all)-i,
+				report.StartedAt.Format("2006-01-02 15:04:05"), len(report.Results), fastest, latency)
+		}
+		return tw.Flush()
+	case "json":
+		return writeJSON(os.Stdout, store.Query(q))
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+func exportCmd(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	run := fs.Int("run", 1, "run to export as numbered by \"history\"; 1 is the most recent")
+	format := fs.String("format", dnsbench.FormatJSON, "output format: json, ndjson or csv")
+	output := fs.String("o", "", "file to write; standard output if empty")
+	parseFlags(fs, args)
+
+	if !validFormat(*format) {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	store, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	runs := store.Runs()
+	if *run < 1 || *run > len(runs) {
+		return fmt.Errorf("no run %d in history (%d saved)", *run, len(runs))
+	}
+	report := runs[len(runs)-*run]
+
+	if *output == "" {
+		return dnsbench.Export(os.Stdout, report, *format)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := dnsbench.Export(f, report, *format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// validFormat reports whether format is an export format or one of extra.
+func validFormat(format string, extra ...string) bool {
+	for _, f := range append(extra, dnsbench.Formats...) {
+		if format == f {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// ms formats d in milliseconds with one decimal.
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// msIfSet is ms(d), or "" for a figure that was not measured.
+func msIfSet(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return ms(d)
+}
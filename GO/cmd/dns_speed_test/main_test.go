@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/settings"
+)
+
+func TestParseProvider(t *testing.T) {
+	known := append([]dnsbench.DNSProvider{{Name: "Lab", IP: "10.0.0.53", Port: 5300}}, dnsbench.DefaultProviders...)
+	tests := []struct {
+		in         string
+		ip, ipv6   string
+		url        string
+		port       int
+		name       string
+		shouldFail bool
+	}{
+		{in: "google", ip: "8.8.8.8", ipv6: "2001:4860:4860::8888", name: "Google"},
+		{in: "192.0.2.1", ip: "192.0.2.1", name: "192.0.2.1"},
+		{in: "192.0.2.1:5353", ip: "192.0.2.1", port: 5353, name: "192.0.2.1:5353"},
+		{in: "lab", ip: "10.0.0.53", port: 5300, name: "Lab"},
+		{in: "[2001:db8::1]:53", ipv6: "2001:db8::1", port: 53, name: "[2001:db8::1]:53"},
+		{in: "https://dns.example/dns-query", url: "https://dns.example/dns-query", name: "https://dns.example/dns-query"},
+		{in: "nonexistent", shouldFail: true},
+		{in: "192.0.2.1:0", shouldFail: true},
+	}
+	for _, tt := range tests {
+		p, err := parseProvider(tt.in, known)
+		if tt.shouldFail {
+			if err == nil {
+				t.Errorf("%s: accepted as %+v", tt.in, p)
+			}
+			continue
+		}
+		if err != nil || p.Name != tt.name || p.IP != tt.ip || p.IPv6 != tt.ipv6 || p.URL != tt.url || p.Port != tt.port {
+			t.Errorf("%s: got %+v, %v", tt.in, p, err)
+		}
+	}
+}
+
+func TestSelectProviders(t *testing.T) {
+	s := settings.Settings{Providers: []settings.Provider{
+		{DNSProvider: dnsbench.DNSProvider{Name: "Corp", IP: "10.0.0.1", Transport: dnsbench.TransportDoT}, Enabled: true},
+		{DNSProvider: dnsbench.DNSProvider{Name: "Lab", IP: "10.0.0.2"}},
+	}}
+	doh, err := selectProviders(s, "", "doh", 4)
+	if err != nil || len(doh) != 3 {
+		t.Fatalf("doh providers = %v, %v; want the 3 built-in DoH providers", doh, err)
+	}
+	all, _ := selectProviders(s, "", "", 4)
+	if len(all) != len(dnsbench.DefaultProviders)+1 || all[len(all)-1].Name != "Corp" {
+		t.Errorf("default providers = %v, want the built-ins and Corp", all)
+	}
+	tcp, _ := selectProviders(s, "corp,lab", "tcp", 4)
+	if len(tcp) != 1 || tcp[0].Name != "Lab" {
+		t.Errorf("TCP providers = %v, want Lab", tcp)
+	}
+	v6, _ := selectProviders(s, "comodo,google,cloudflare doh", "", 6)
+	if len(v6) != 2 || v6[0].Name != "Google" || v6[1].Name != "Cloudflare DoH" {
+		t.Errorf("IPv6 providers = %v, want Google and Cloudflare DoH", v6)
+	}
+	dot, _ := selectProviders(s, "google,cloudflare doh", "dot", 4)
+	if len(dot) != 1 || dot[0].Name != "Google" {
+		t.Errorf("DoT providers = %v, want Google", dot)
+	}
+}
+
+func TestPrintTableOptionalColumns(t *testing.T) {
+	results := []dnsbench.TestResult{
+		{
+			Provider:      dnsbench.DNSProvider{Name: "Fast", IP: "192.0.2.1"},
+			Success:       true,
+			Stats:         dnsbench.Stats{Median: 10 * time.Millisecond},
+			UncachedStats: dnsbench.Stats{Median: 80 * time.Millisecond},
+		},
+		{
+			Provider:          dnsbench.DNSProvider{Name: "TLS", IP: "192.0.2.3"},
+			Success:           true,
+			Stats:             dnsbench.Stats{Median: 15 * time.Millisecond},
+			FirstQueryLatency: 45 * time.Millisecond,
+			ReusedLatency:     14 * time.Millisecond,
+			HandshakeLatency:  30 * time.Millisecond,
+		},
+		{
+			Provider:          dnsbench.DNSProvider{Name: "QUIC", IP: "192.0.2.4"},
+			Success:           true,
+			Stats:             dnsbench.Stats{Median: 12 * time.Millisecond},
+			FirstQueryLatency: 30 * time.Millisecond,
+			HandshakeLatency:  25 * time.Millisecond,
+			ZeroRTTLatency:    20 * time.Millisecond,
+			OneRTTLatency:     40 * time.Millisecond,
+		},
+		{
+			Provider:      dnsbench.DNSProvider{Name: "Broken", IP: "192.0.2.2"},
+			Success:       true,
+			Stats:         dnsbench.Stats{Median: 20 * time.Millisecond},
+			UncachedStats: dnsbench.Stats{Loss: 100},
+		},
+	}
+	var b strings.Builder
+	printTable(&b, results)
+	table := b.String()
+	row := func(provider string) string {
+		for _, line := range strings.Split(table, "\n") {
+			if strings.HasPrefix(line, provider+" ") {
+				return line
+			}
+		}
+		t.Fatalf("no row for %s in\n%s", provider, table)
+		return ""
+	}
+	for _, column := range []string{"Uncached", "First Query", "Reused", "Handshake", "0-RTT", "1-RTT"} {
+		if !strings.Contains(strings.Split(table, "\n")[2], column) {
+			t.Errorf("no %s column in\n%s", column, table)
+		}
+	}
+	if fast := row("Fast"); !strings.Contains(fast, "80.0ms") {
+		t.Errorf("row %q does not show the uncached median", fast)
+	}
+	if broken := row("Broken"); !strings.Contains(broken, "Timeout or Error") {
+		t.Errorf("row %q does not show the uncached queries failing", broken)
+	}
+	if tls := strings.Fields(row("TLS")); strings.Join(tls[len(tls)-5:], " ") != "45.0ms 14.0ms 30.0ms - -" {
+		t.Errorf("row %q does not end with the first query, reused and handshake latency", tls)
+	}
+	if quic := strings.Fields(row("QUIC")); strings.Join(quic[len(quic)-2:], " ") != "20.0ms 40.0ms" {
+		t.Errorf("row %q does not end with the 0-RTT and 1-RTT latency", quic)
+	}
+
+	var plain strings.Builder
+	results[0].UncachedStats = dnsbench.Stats{}
+	printTable(&plain, results[:1])
+	if header := strings.Split(plain.String(), "\n")[2]; strings.Contains(header, "Uncached") || strings.Contains(header, "Reused") {
+		t.Errorf("optional columns shown without values: %q", header)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"sort"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+
+	"dns_speed_test/dnsbench"
+)
+
+// Chart geometry in dp.
+const (
+	chartLabelWidth = 150 // provider names left of the plot
+	chartValueWidth = 70  // values right of bars
+	chartRowHeight  = 24
+	chartAxisHeight = 20
+	scatterHeight   = 200
+	scatterDot      = 3
+)
+
+// chartPalette is the Tableau 10 palette, distinguishable on white.
+var chartPalette = []color.NRGBA{
+	{R: 0x4e, G: 0x79, B: 0xa7, A: 0xff},
+	{R: 0xf2, G: 0x8e, B: 0x2b, A: 0xff},
+	{R: 0x59, G: 0xa1, B: 0x4f, A: 0xff},
+	{R: 0xb0, G: 0x7a, B: 0xa1, A: 0xff},
+	{R: 0x76, G: 0xb7, B: 0xb2, A: 0xff},
+	{R: 0xed, G: 0xc9, B: 0x48, A: 0xff},
+	{R: 0x9c, G: 0x75, B: 0x5f, A: 0xff},
+	{R: 0xff, G: 0x9d, B: 0xa7, A: 0xff},
+	{R: 0xba, G: 0xb0, B: 0xac, A: 0xff},
+	{R: 0x7f, G: 0x7f, B: 0x7f, A: 0xff},
+}
+
+var (
+	failColor  = color.NRGBA{R: 0xe1, G: 0x57, B: 0x59, A: 0xff}
+	gridColor  = color.NRGBA{R: 0xdd, G: 0xdd, B: 0xdd, A: 0xff}
+	inkColor   = color.NRGBA{R: 0x30, G: 0x30, B: 0x30, A: 0xff}
+	labelColor = color.NRGBA{R: 0x60, G: 0x60, B: 0x60, A: 0xff}
+)
+
+// chartColors gives each provider a colour of its own, in the order they
+// were tested, so a provider looks the same in every chart.
+func chartColors(providers []dnsbench.DNSProvider) map[string]color.NRGBA {
+	colors := make(map[string]color.NRGBA)
+	for i, p := range providers {
+		colors[p.Name] = chartPalette[i%len(chartPalette)]
+	}
+	return colors
+}
+
+// niceScale rounds d up to 1, 2 or 5 times a power of ten milliseconds, so
+// that the axis has round numbers at its ends and middle.
+func niceScale(d time.Duration) time.Duration {
+	scale := time.Millisecond
+	for {
+		for _, m := range []time.Duration{1, 2, 5} {
+			if m*scale >= d {
+				return m * scale
+			}
+		}
+		scale *= 10
+	}
+}
+
+// chart draws a plot whose horizontal axis is a duration from 0 to scale,
+// with a label column on the left.
+type chart struct {
+	gtx   layout.Context
+	th    *material.Theme
+	scale time.Duration
+	left  int // x of the plot's origin
+	width int
+}
+
+func newChart(gtx layout.Context, th *material.Theme, left, right unit.Dp, scale time.Duration) *chart {
+	c := &chart{gtx: gtx, th: th, scale: scale, left: gtx.Dp(left)}
+	c.width = gtx.Constraints.Max.X - c.left - gtx.Dp(right)
+	if c.width < 1 {
+		c.width = 1
+	}
+	return c
+}
+
+// x maps d to a horizontal position, clamped to the plot.
+func (c *chart) x(d time.Duration) int {
+	if d > c.scale {
+		d = c.scale
+	}
+	if d < 0 {
+		d = 0
+	}
+	return c.left + int(int64(c.width)*int64(d)/int64(c.scale))
+}
+
+func (c *chart) fill(r image.Rectangle, col color.NRGBA) {
+	paint.FillShape(c.gtx.Ops, col, clip.Rect(r).Op())
+}
+
+func (c *chart) dot(x, y, r int, col color.NRGBA) {
+	paint.FillShape(c.gtx.Ops, col, clip.Ellipse(image.Rect(x-r, y-r, x+r, y+r)).Op(c.gtx.Ops))
+}
+
+// text draws a single-line caption with its top left corner at x, y and
+// returns its size.
+func (c *chart) text(x, y int, s string, col color.NRGBA) image.Point {
+	defer op.Offset(image.Pt(x, y)).Push(c.gtx.Ops).Pop()
+	gtx := c.gtx
+	gtx.Constraints.Min = image.Point{}
+	l := material.Caption(c.th, s)
+	l.Color = col
+	l.MaxLines = 1
+	return l.Layout(gtx).Size
+}
+
+// grid draws vertical lines at 0, half and full scale from top to bottom,
+// and their values below bottom.
+func (c *chart) grid(top, bottom int) {
+	for _, f := range []time.Duration{0, 1, 2} {
+		d := c.scale * f / 2
+		x := c.x(d)
+		c.fill(image.Rect(x, top, x+1, bottom), gridColor)
+		c.text(x+2, bottom, ms(d), labelColor)
+	}
+}
+
+// successLatencies lists the latencies of a result's successful cacheable
+// queries in ascending order.
+func successLatencies(r dnsbench.TestResult) []time.Duration {
+	var latencies []time.Duration
+	for _, q := range r.Queries {
+		if q.Success && !q.Uncached {
+			latencies = append(latencies, q.Latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies
+}
+
+// quantile picks the nearest-rank value for p in [0, 1] from sorted.
+func quantile(sorted []time.Duration, p float64) time.Duration {
+	i := int(p*float64(len(sorted)-1) + 0.5)
+	return sorted[i]
+}
+
+// layoutBarChart draws one bar per provider for its median latency,
+// fastest at the top. Providers without a successful query come last.
+func layoutBarChart(gtx layout.Context, th *material.Theme, results []dnsbench.TestResult, colors map[string]color.NRGBA) layout.Dimensions {
+	ranked := append([]dnsbench.TestResult(nil), results...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Success != ranked[j].Success {
+			return ranked[i].Success
+		}
+		return ranked[i].Median < ranked[j].Median
+	})
+	var slowest time.Duration
+	for _, r := range ranked {
+		if r.Success && r.Median > slowest {
+			slowest = r.Median
+		}
+	}
+
+	c := newChart(gtx, th, chartLabelWidth, chartValueWidth, niceScale(slowest))
+	row := gtx.Dp(chartRowHeight)
+	pad := row / 6
+	bottom := row * len(ranked)
+	c.grid(0, bottom)
+	for i, r := range ranked {
+		y := i * row
+		c.text(0, y+pad, r.Provider.Name, inkColor)
+		if !r.Success {
+			c.text(c.left+pad, y+pad, "failed", failColor)
+			continue
+		}
+		x := c.x(r.Median)
+		c.fill(image.Rect(c.left, y+pad, x, y+row-pad), colors[r.Provider.Name])
+		c.text(x+pad, y+pad, ms(r.Median), inkColor)
+	}
+	return layout.Dimensions{Size: image.Pt(gtx.Constraints.Max.X, bottom+gtx.Dp(chartAxisHeight))}
+}
+
+// layoutBoxPlot draws the latency distribution of every provider that
+// answered: whiskers from the fastest to the slowest query, a box from the
+// first to the third quartile and a line at the median.
+func layoutBoxPlot(gtx layout.Context, th *material.Theme, results []dnsbench.TestResult, colors map[string]color.NRGBA) layout.Dimensions {
+	var answered []dnsbench.TestResult
+	var slowest time.Duration
+	for _, r := range results {
+		if len(successLatencies(r)) > 0 {
+			answered = append(answered, r)
+			if r.Max > slowest {
+				slowest = r.Max
+			}
+		}
+	}
+
+	c := newChart(gtx, th, chartLabelWidth, chartValueWidth, niceScale(slowest))
+	row := gtx.Dp(chartRowHeight)
+	pad := row / 6
+	bottom := row * len(answered)
+	c.grid(0, bottom)
+	for i, r := range answered {
+		y := i * row
+		mid := y + row/2
+		latencies := successLatencies(r)
+		c.text(0, y+pad, r.Provider.Name, inkColor)
+		lo, q1, med, q3, hi := c.x(latencies[0]), c.x(quantile(latencies, 0.25)),
+			c.x(quantile(latencies, 0.5)), c.x(quantile(latencies, 0.75)), c.x(latencies[len(latencies)-1])
+		c.fill(image.Rect(lo, mid, hi+1, mid+1), inkColor)
+		c.fill(image.Rect(lo, y+2*pad, lo+1, y+row-2*pad), inkColor)
+		c.fill(image.Rect(hi, y+2*pad, hi+1, y+row-2*pad), inkColor)
+		c.fill(image.Rect(q1, y+pad, q3+1, y+row-pad), colors[r.Provider.Name])
+		c.fill(image.Rect(med-1, y+pad, med+1, y+row-pad), inkColor)
+		c.text(hi+pad, y+pad, ms(r.Max), labelColor)
+	}
+	return layout.Dimensions{Size: image.Pt(gtx.Constraints.Max.X, bottom+gtx.Dp(chartAxisHeight))}
+}
+
+// layoutScatter plots every query of a run: when it finished, since start,
+// against how long it took. Failed queries are drawn along the top edge.
+// Below the plot a legend names the providers in order.
+func layoutScatter(gtx layout.Context, th *material.Theme, providers []dnsbench.DNSProvider, queries []dnsbench.QueryResult, start time.Time, colors map[string]color.NRGBA) layout.Dimensions {
+	var slowest, duration time.Duration
+	for _, q := range queries {
+		if q.Success && q.Latency > slowest {
+			slowest = q.Latency
+		}
+		if end := q.TimeStamp.Add(q.Latency).Sub(start); end > duration {
+			duration = end
+		}
+	}
+	scale := niceScale(slowest)
+	if duration < time.Second {
+		duration = time.Second
+	}
+
+	// The chart's own axis is the run time; latency runs upwards.
+	c := newChart(gtx, th, chartValueWidth, unit.Dp(10), duration)
+	top := gtx.Dp(unit.Dp(8))
+	height := gtx.Dp(scatterHeight)
+	bottom := top + height
+	r := gtx.Dp(scatterDot)
+	y := func(d time.Duration) int {
+		if d > scale {
+			d = scale
+		}
+		return bottom - int(int64(height)*int64(d)/int64(scale))
+	}
+
+	for _, f := range []time.Duration{0, 1, 2} {
+		d := scale * f / 2
+		c.fill(image.Rect(c.left, y(d), c.left+c.width, y(d)+1), gridColor)
+		c.text(0, y(d)-gtx.Dp(unit.Dp(8)), ms(d), labelColor)
+	}
+	c.fill(image.Rect(c.left, top, c.left+1, bottom), gridColor)
+	c.text(c.left, bottom, "0s", labelColor)
+	c.text(c.left+c.width-gtx.Dp(unit.Dp(40)), bottom, duration.Round(100*time.Millisecond).String(), labelColor)
+
+	for _, q := range queries {
+		x := c.x(q.TimeStamp.Add(q.Latency).Sub(start))
+		if q.Success {
+			c.dot(x, y(q.Latency), r, colors[q.Provider])
+		} else {
+			c.fill(image.Rect(x-r, top-r, x+r, top+r), failColor)
+		}
+	}
+
+	// Legend, wrapped to the width of the chart.
+	x, ly := c.left, bottom+gtx.Dp(chartAxisHeight)
+	entry := gtx.Dp(chartLabelWidth)
+	for _, p := range providers {
+		if x+entry > gtx.Constraints.Max.X && x > c.left {
+			x, ly = c.left, ly+gtx.Dp(chartRowHeight)
+		}
+		c.fill(image.Rect(x, ly+r, x+2*r, ly+3*r), colors[p.Name])
+		c.text(x+3*r, ly, p.Name, inkColor)
+		x += entry
+	}
+	if len(providers) > 0 {
+		ly += gtx.Dp(chartRowHeight)
+	}
+	return layout.Dimensions{Size: image.Pt(gtx.Constraints.Max.X, ly)}
+}
+
+// resultSections lists what the Test tab shows below the progress bar: the
+// live scatter of the current or last run, the charts of its results once
+// they are in, and the detailed figures.
+func (ui *UI) resultSections() []layout.Widget {
+	var sections []layout.Widget
+	heading := func(text string) layout.Widget {
+		return func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Top: unit.Dp(10), Bottom: unit.Dp(5)}.Layout(gtx, material.Body1(ui.theme, text).Layout)
+		}
+	}
+	sections = append(sections, ui.monitorSections(heading)...)
+	if len(ui.runProviders) > 0 {
+		sections = append(sections, heading("Queries over time"), func(gtx layout.Context) layout.Dimensions {
+			return layoutScatter(gtx, ui.theme, ui.runProviders, ui.runQueries, ui.runStart, ui.colors)
+		})
+	}
+	if results := ui.report.Results; len(results) > 0 && ui.report.StartedAt.Equal(ui.runStart) {
+		sections = append(sections,
+			heading("Median latency"),
+			func(gtx layout.Context) layout.Dimensions {
+				return layoutBarChart(gtx, ui.theme, results, ui.colors)
+			},
+			heading("Latency distribution"),
+			func(gtx layout.Context) layout.Dimensions {
+				return layoutBoxPlot(gtx, ui.theme, results, ui.colors)
+			},
+		)
+	}
+	if ui.results != "" {
+		sections = append(sections, heading("Details"), material.Body1(ui.theme, ui.results).Layout)
+	}
+	return sections
+}
+
+// layoutTrend draws a provider's median latency across runs as a line,
+// oldest run on the left. Runs where it failed are marked on the top edge.
+func layoutTrend(gtx layout.Context, th *material.Theme, points []dnsbench.TrendPoint, col color.NRGBA) layout.Dimensions {
+	var slowest time.Duration
+	for _, p := range points {
+		if p.Success && p.Median > slowest {
+			slowest = p.Median
+		}
+	}
+	scale := niceScale(slowest)
+
+	// Only the chart's geometry is used: runs are placed by x below.
+	c := newChart(gtx, th, chartValueWidth, unit.Dp(10), 1)
+	top := gtx.Dp(unit.Dp(8))
+	height := gtx.Dp(scatterHeight)
+	bottom := top + height
+	r := gtx.Dp(scatterDot)
+	y := func(d time.Duration) int {
+		if d > scale {
+			d = scale
+		}
+		return bottom - int(int64(height)*int64(d)/int64(scale))
+	}
+	// Runs are spread evenly, each in the middle of its slot.
+	x := func(i int) int {
+		return c.left + (2*i+1)*c.width/(2*len(points))
+	}
+
+	for _, f := range []time.Duration{0, 1, 2} {
+		d := scale * f / 2
+		c.fill(image.Rect(c.left, y(d), c.left+c.width, y(d)+1), gridColor)
+		c.text(0, y(d)-gtx.Dp(unit.Dp(8)), ms(d), labelColor)
+	}
+	if len(points) == 0 {
+		c.text(c.left, bottom, "No runs", labelColor)
+		return layout.Dimensions{Size: image.Pt(gtx.Constraints.Max.X, bottom+gtx.Dp(chartAxisHeight))}
+	}
+	c.text(c.left, bottom, points[0].StartedAt.Format("2006-01-02 15:04"), labelColor)
+	if len(points) > 1 {
+		c.text(c.left+c.width-gtx.Dp(unit.Dp(100)), bottom, points[len(points)-1].StartedAt.Format("2006-01-02 15:04"), labelColor)
+	}
+
+	var path clip.Path
+	path.Begin(gtx.Ops)
+	started := false
+	for i, p := range points {
+		if !p.Success {
+			continue
+		}
+		pt := f32.Pt(float32(x(i)), float32(y(p.Median)))
+		if started {
+			path.LineTo(pt)
+		} else {
+			path.MoveTo(pt)
+			started = true
+		}
+	}
+	paint.FillShape(gtx.Ops, col, clip.Stroke{Path: path.End(), Width: float32(gtx.Dp(unit.Dp(2)))}.Op())
+	for i, p := range points {
+		if p.Success {
+			c.dot(x(i), y(p.Median), r, col)
+		} else {
+			c.fill(image.Rect(x(i)-r, top-r, x(i)+r, top+r), failColor)
+		}
+	}
+	return layout.Dimensions{Size: image.Pt(gtx.Constraints.Max.X, bottom+gtx.Dp(chartAxisHeight))}
+}
@@ -0,0 +1,937 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gioui.org/app"
+	"gioui.org/io/system"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/history"
+	"dns_speed_test/settings"
+)
+
+type DNSProvider struct {
+	dnsbench.DNSProvider
+	Group    string
+	Selected widget.Bool
+}
+
+// UI is owned by the goroutine running loop: only it may touch the fields
+// below. Other goroutines hand work back to it with post, and a run reports
+// its progress through the counter completed points to.
+type UI struct {
+	window           *app.Window
+	updates          chan func()
+	saves            chan settings.Settings
+	completed        *atomic.Int64
+	totalTests       int
+	theme            *material.Theme
+	providers        []*DNSProvider
+	customProviders  []settings.Provider
+	editor           providerEditor
+	domainSets       []settings.DomainSet
+	domainEditor     domainSetEditor
+	configList       widget.List
+	startButton      widget.Clickable
+	stopButton       widget.Clickable
+	pauseButton      widget.Clickable
+	cancel           context.CancelFunc
+	pause            pauser
+	runID            int
+	exportButton     widget.Clickable
+	configButton     widget.Clickable
+	results          string
+	status           string
+	testing          bool
+	config           dnsbench.TestConfig
+	list             *widget.List
+	tabs             *widget.Enum
+	showConfig       bool
+	report           dnsbench.Report
+	runProviders     []dnsbench.DNSProvider
+	runQueries       []dnsbench.QueryResult
+	runStart         time.Time
+	colors           map[string]color.NRGBA
+	testHistory      []dnsbench.Report
+	store            *history.Store
+	unmigrated       []dnsbench.Report
+	history          historyView
+	retention        settings.Retention
+	monitor          monitorView
+	exportFormat     widget.Enum
+	errorLog         []string
+	decreaseTests    widget.Clickable
+	increaseTests    widget.Clickable
+	decreaseTimeout  widget.Clickable
+	increaseTimeout  widget.Clickable
+	useTCPCheckbox   widget.Bool
+	useTLSCheckbox   widget.Bool
+	useQUICCheckbox  widget.Bool
+	doqReconnect     widget.Bool
+	useIPv6Checkbox  widget.Bool
+	parallelCheckbox widget.Bool
+	dohPostCheckbox  widget.Bool
+	queryType        widget.Enum
+	uncachedCheckbox widget.Bool
+	uncachedZone     widget.Editor
+	checkAnswers     widget.Bool
+	checkDNSSEC      widget.Bool
+	identifyResolver widget.Bool
+	clientSubnet     widget.Editor
+	resultsList      widget.List
+}
+
+func main() {
+	go func() {
+		w := app.NewWindow(
+			app.Title("DNS Speed Test"),
+			app.Size(unit.Dp(800), unit.Dp(600)),
+		)
+		ui := &UI{
+			window:  w,
+			updates: make(chan func(), 16),
+			saves:   make(chan settings.Settings, 1),
+			theme:   material.NewTheme(),
+			list:    &widget.List{List: layout.List{Axis: layout.Vertical}},
+			tabs:    &widget.Enum{},
+			config:  dnsbench.DefaultConfig(),
+			// Initialize configuration controls
+			useTCPCheckbox:   widget.Bool{Value: false},
+			useIPv6Checkbox:  widget.Bool{Value: false},
+			parallelCheckbox: widget.Bool{Value: true},
+			resultsList:      widget.List{List: layout.List{Axis: layout.Vertical}},
+		}
+		ui.tabs.Value = "test"
+		ui.queryType.Value = "A"
+		ui.exportFormat.Value = dnsbench.FormatCSV
+		ui.uncachedZone.SingleLine = true
+		ui.clientSubnet.SingleLine = true
+		ui.editor.init()
+		ui.history.init()
+		ui.monitor.init()
+		ui.rebuildProviders(nil)
+		ui.domainEditor.init()
+		ui.domainSets = settings.New().DomainSets
+		ui.selectDomainSet(settings.DefaultDomainSet)
+		ui.configList.Axis = layout.Vertical
+		ui.status = "Ready to test DNS servers"
+
+		// Load saved settings
+		if err := ui.loadSettings(); err != nil {
+			fmt.Printf("Failed to load settings: %v\n", err)
+		}
+		go ui.saveLoop()
+
+		if err := ui.loop(); err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+	}()
+	app.Main()
+}
+
+func (ui *UI) loop() error {
+	var ops op.Ops
+	for {
+		select {
+		case e := <-ui.window.Events():
+			switch e := e.(type) {
+			case system.DestroyEvent:
+				return e.Err
+			case system.FrameEvent:
+				gtx := layout.NewContext(&ops, e)
+				ui.layout(gtx)
+				e.Frame(gtx.Ops)
+			}
+		case update := <-ui.updates:
+			update()
+			ui.window.Invalidate()
+		}
+	}
+}
+
+// post runs update on the UI goroutine.
+func (ui *UI) post(update func()) {
+	ui.updates <- update
+}
+
+// progress is the fraction of the current run's queries that have finished.
+func (ui *UI) progress() float32 {
+	if ui.completed == nil || ui.totalTests == 0 {
+		return 0
+	}
+	return float32(ui.completed.Load()) / float32(ui.totalTests)
+}
+
+func (ui *UI) layout(gtx layout.Context) layout.Dimensions {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return ui.layoutTabs(gtx)
+		}),
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			switch ui.tabs.Value {
+			case "test":
+				return ui.layoutTest(gtx)
+			case "history":
+				return ui.layoutHistory(gtx)
+			case "providers":
+				return ui.layoutProviders(gtx)
+			case "config":
+				return ui.layoutConfig(gtx)
+			default:
+				return layout.Dimensions{}
+			}
+		}),
+	)
+}
+
+func (ui *UI) layoutTabs(gtx layout.Context) layout.Dimensions {
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.RadioButton(ui.theme, ui.tabs, "test", "Test").Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.RadioButton(ui.theme, ui.tabs, "history", "History").Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.RadioButton(ui.theme, ui.tabs, "providers", "Providers").Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.RadioButton(ui.theme, ui.tabs, "config", "Config").Layout(gtx)
+		}),
+	)
+}
+
+func (ui *UI) layoutTest(gtx layout.Context) layout.Dimensions {
+	if ui.startButton.Clicked() && !ui.testing {
+		ui.monitor.stop()
+		if !ui.monitor.enabled.Value || ui.startMonitor() {
+			ui.runTests()
+		}
+		if !ui.testing {
+			ui.monitor.stop()
+		}
+	}
+	if ui.stopButton.Clicked() && (ui.testing || ui.monitor.active) {
+		ui.stopTests()
+	}
+	if ui.pauseButton.Clicked() && ui.testing {
+		if ui.pause.paused() {
+			ui.pause.resume()
+			ui.status = "Testing DNS servers..."
+		} else {
+			ui.pause.pause()
+			ui.status = "Paused; queries already sent will still finish"
+		}
+	}
+	if ui.exportButton.Clicked() && len(ui.report.Results) > 0 {
+		go ui.exportResults(ui.report, ui.exportFormat.Value)
+	}
+	for _, p := range ui.providers {
+		if p.Selected.Changed() {
+			ui.saveSettings()
+			break
+		}
+	}
+	if ui.monitor.changed() {
+		ui.saveSettings()
+	}
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.H6(ui.theme, "DNS Providers").Layout(gtx)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			var children []layout.FlexChild
+			for i := range ui.providers {
+				i := i
+				if group := ui.providers[i].Group; i == 0 || group != ui.providers[i-1].Group {
+					children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return material.Body1(ui.theme, group).Layout(gtx)
+					}))
+				}
+				children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					provider := ui.providers[i]
+					return material.CheckBox(ui.theme, &provider.Selected,
+						fmt.Sprintf("%s (%s%s)",
+							provider.Name,
+							provider.Address(),
+							func() string {
+								if provider.IPv6 != "" && ui.config.UseIPv6 {
+									return ", " + provider.IPv6
+								}
+								return ""
+							}(),
+						)).Layout(gtx)
+				}))
+			}
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					btn := material.Button(ui.theme, &ui.startButton, "Start Test")
+					if ui.testing {
+						btn.Background = color.NRGBA{R: 200, G: 200, B: 200, A: 255}
+					}
+					return btn.Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					label := "Pause"
+					if ui.pause.paused() {
+						label = "Resume"
+					}
+					btn := material.Button(ui.theme, &ui.pauseButton, label)
+					if !ui.testing {
+						btn.Background = color.NRGBA{R: 200, G: 200, B: 200, A: 255}
+					}
+					return btn.Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					btn := material.Button(ui.theme, &ui.stopButton, "Stop")
+					if !ui.testing && !ui.monitor.active {
+						btn.Background = color.NRGBA{R: 200, G: 200, B: 200, A: 255}
+					}
+					return btn.Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Button(ui.theme, &ui.exportButton, "Export Results").Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					var formats []layout.FlexChild
+					for _, f := range dnsbench.Formats {
+						f := f
+						formats = append(formats, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return material.RadioButton(ui.theme, &ui.exportFormat, f, strings.ToUpper(f)).Layout(gtx)
+						}))
+					}
+					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, formats...)
+				}),
+			)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+		layout.Rigid(ui.layoutMonitorControls),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Body1(ui.theme, ui.status).Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			progressBar := material.ProgressBar(ui.theme, ui.progress())
+			return progressBar.Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			return layout.UniformInset(unit.Dp(10)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				sections := ui.resultSections()
+				return material.List(ui.theme, &ui.resultsList).Layout(gtx, len(sections), func(gtx layout.Context, i int) layout.Dimensions {
+					return sections[i](gtx)
+				})
+			})
+		}),
+	)
+}
+
+func (ui *UI) layoutConfig(gtx layout.Context) layout.Dimensions {
+	// Save settings whenever they change
+	if ui.decreaseTests.Clicked() || ui.increaseTests.Clicked() ||
+		ui.decreaseTimeout.Clicked() || ui.increaseTimeout.Clicked() ||
+		ui.useTCPCheckbox.Changed() || ui.useTLSCheckbox.Changed() || ui.useIPv6Checkbox.Changed() ||
+		ui.useQUICCheckbox.Changed() || ui.doqReconnect.Changed() ||
+		ui.parallelCheckbox.Changed() || ui.dohPostCheckbox.Changed() || ui.queryType.Changed() ||
+		ui.uncachedCheckbox.Changed() || edited(&ui.uncachedZone) || ui.checkAnswers.Changed() ||
+		ui.checkDNSSEC.Changed() || ui.identifyResolver.Changed() || edited(&ui.clientSubnet) {
+		ui.saveSettings()
+	}
+
+	return material.List(ui.theme, &ui.configList).Layout(gtx, 1, func(gtx layout.Context, _ int) layout.Dimensions {
+		return ui.layoutConfigOptions(gtx)
+	})
+}
+
+func (ui *UI) layoutConfigOptions(gtx layout.Context) layout.Dimensions {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.H6(ui.theme, "Configuration").Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Body1(ui.theme, fmt.Sprintf("Tests per domain: %d", ui.config.TestsPerDomain)).Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							btn := material.Button(ui.theme, &ui.decreaseTests, "-")
+							dims := btn.Layout(gtx)
+							if ui.decreaseTests.Clicked() {
+								if ui.config.TestsPerDomain > 1 {
+									ui.config.TestsPerDomain--
+								}
+							}
+							return dims
+						}),
+						layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							btn := material.Button(ui.theme, &ui.increaseTests, "+")
+							dims := btn.Layout(gtx)
+							if ui.increaseTests.Clicked() {
+								if ui.config.TestsPerDomain < 10 {
+									ui.config.TestsPerDomain++
+								}
+							}
+							return dims
+						}),
+					)
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Body1(ui.theme, fmt.Sprintf("Timeout: %v", ui.config.Timeout)).Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							btn := material.Button(ui.theme, &ui.decreaseTimeout, "-")
+							dims := btn.Layout(gtx)
+							if ui.decreaseTimeout.Clicked() {
+								if ui.config.Timeout > time.Second {
+									ui.config.Timeout -= time.Second
+								}
+							}
+							return dims
+						}),
+						layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							btn := material.Button(ui.theme, &ui.increaseTimeout, "+")
+							dims := btn.Layout(gtx)
+							if ui.increaseTimeout.Clicked() {
+								if ui.config.Timeout < 10*time.Second {
+									ui.config.Timeout += time.Second
+								}
+							}
+							return dims
+						}),
+					)
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.useTCPCheckbox, "Use TCP for DNS queries").Layout(gtx)
+					ui.config.UseTCP = ui.useTCPCheckbox.Value
+					return dims
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.useTLSCheckbox, "Use DNS-over-TLS (port 853)").Layout(gtx)
+					ui.config.UseTLS = ui.useTLSCheckbox.Value
+					return dims
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.useQUICCheckbox, "Use DNS-over-QUIC (port 853)").Layout(gtx)
+					ui.config.UseQUIC = ui.useQUICCheckbox.Value
+					return dims
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.doqReconnect, "New QUIC connection per query (measures 0-RTT)").Layout(gtx)
+					ui.config.DoQReconnect = ui.doqReconnect.Value
+					return dims
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.useIPv6Checkbox, "Use IPv6 when available").Layout(gtx)
+					ui.config.UseIPv6 = ui.useIPv6Checkbox.Value
+					return dims
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.parallelCheckbox, "Run tests in parallel").Layout(gtx)
+					ui.config.ParallelTests = ui.parallelCheckbox.Value
+					return dims
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.dohPostCheckbox, "Use POST for DNS-over-HTTPS").Layout(gtx)
+					ui.config.DoHMethod = http.MethodGet
+					if ui.dohPostCheckbox.Value {
+						ui.config.DoHMethod = http.MethodPost
+					}
+					return dims
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Body1(ui.theme, "Query type:").Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					var children []layout.FlexChild
+					for _, t := range dnsbench.QueryTypes {
+						t := t
+						children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return material.RadioButton(ui.theme, &ui.queryType, t, t).Layout(gtx)
+						}))
+					}
+					dims := layout.Flex{Axis: layout.Horizontal}.Layout(gtx, children...)
+					ui.config.QueryType = ui.queryType.Value
+					return dims
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.uncachedCheckbox, "Also query uncached random names").Layout(gtx)
+					ui.config.UncachedTests = ui.uncachedCheckbox.Value
+					return dims
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.Editor(ui.theme, &ui.uncachedZone, "Zone for random names (default: each test domain)").Layout(gtx)
+					ui.config.UncachedZone = strings.TrimSpace(ui.uncachedZone.Text())
+					return dims
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.checkAnswers, "Check answers for hijacking and NXDOMAIN redirects").Layout(gtx)
+					ui.config.CheckAnswers = ui.checkAnswers.Value
+					return dims
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.checkDNSSEC, "Check whether providers validate DNSSEC").Layout(gtx)
+					ui.config.CheckDNSSEC = ui.checkDNSSEC.Value
+					return dims
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.CheckBox(ui.theme, &ui.identifyResolver, "Identify the resolver instance (NSID, id.server, hostname.bind)").Layout(gtx)
+					ui.config.IdentifyResolver = ui.identifyResolver.Value
+					return dims
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					dims := material.Editor(ui.theme, &ui.clientSubnet, "Client subnet to send with EDNS Client Subnet, e.g. 198.51.100.0/24 (default: none)").Layout(gtx)
+					ui.config.ClientSubnet = strings.TrimSpace(ui.clientSubnet.Text())
+					return dims
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
+				layout.Rigid(ui.layoutDomainSets),
+			)
+		}),
+	)
+}
+
+// exportResults writes report to the Documents folder in format and reveals
+// the file. It runs on its own goroutine.
+func (ui *UI) exportResults(report dnsbench.Report, format string) {
+	fail := func(msg string) {
+		ui.post(func() {
+			ui.errorLog = append(ui.errorLog, msg)
+			ui.status = msg
+		})
+	}
+
+	// Get user's Documents folder
+	userHomeDir, err := os.UserHomeDir()
+	if err != nil {
+		fail(fmt.Sprintf("Failed to get user home directory: %v", err))
+		return
+	}
+	docsDir := filepath.Join(userHomeDir, "Documents")
+
+	// Create filename with the run's timestamp
+	filename := fmt.Sprintf("dns_test_results_%s.%s", report.StartedAt.Format("2006-01-02_15-04-05"), format)
+	filepath := filepath.Join(docsDir, filename)
+
+	// Create and write to file
+	file, err := os.Create(filepath)
+	if err != nil {
+		fail(fmt.Sprintf("Failed to create file: %v", err))
+		return
+	}
+	err = dnsbench.Export(file, report, format)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fail(fmt.Sprintf("Failed to export results: %v", err))
+		return
+	}
+
+	// Open the folder in explorer and highlight the file
+	go func() {
+		switch runtime.GOOS {
+		case "windows":
+			exec.Command("explorer", "/select,", filepath).Run()
+		case "darwin": // macOS
+			exec.Command("open", "-R", filepath).Run()
+		default: // Linux and others
+			exec.Command("xdg-open", docsDir).Run()
+		}
+	}()
+
+	ui.post(func() {
+		ui.status = fmt.Sprintf("Results exported to %s", filepath)
+	})
+}
+
+// runTests starts a run of the selected providers. The queries run on other
+// goroutines; the results are handed back to the UI goroutine when done.
+func (ui *UI) runTests() {
+	var toTest []dnsbench.DNSProvider
+	for _, p := range ui.providers {
+		if !p.Selected.Value {
+			continue
+		}
+		if err := p.Validate(); err != nil {
+			ui.status = fmt.Sprintf("Invalid provider: %v", err)
+			return
+		}
+		toTest = append(toTest, p.DNSProvider)
+	}
+	if len(toTest) == 0 {
+		ui.status = "Please select at least one DNS provider"
+		return
+	}
+	if len(ui.config.Domains) == 0 {
+		ui.status = fmt.Sprintf("The domain set %s is empty", ui.domainEditor.selected.Value)
+		return
+	}
+	if ui.config.ClientSubnet != "" {
+		if _, err := dnsbench.ParseSubnet(ui.config.ClientSubnet); err != nil {
+			ui.status = fmt.Sprintf("Invalid client subnet: %v", err)
+			return
+		}
+	}
+
+	ui.testing = true
+	ui.results = ""
+	ui.runProviders = toTest
+	ui.runQueries = nil
+	ui.colors = chartColors(toTest)
+	ui.status = fmt.Sprintf("Testing DNS servers with %d domains from %s...", len(ui.config.Domains), ui.domainEditor.selected.Value)
+	config := ui.config
+	ui.totalTests = len(toTest) * config.TotalTests()
+	completed := new(atomic.Int64)
+	ui.completed = completed
+	ctx, cancel := context.WithCancel(context.Background())
+	ui.cancel = cancel
+	ui.runID++
+	runID := ui.runID
+	startedAt := time.Now()
+	ui.runStart = startedAt
+
+	go func() {
+		defer cancel()
+		testResults := dnsbench.Run(dnsbench.WithPause(ctx, ui.pause.wait), toTest, config, func(q dnsbench.QueryResult) {
+			completed.Add(1)
+			ui.post(func() {
+				if runID == ui.runID {
+					ui.runQueries = append(ui.runQueries, q)
+				}
+			})
+		})
+		dnsbench.SortByLatency(testResults)
+		cancelled := ctx.Err() != nil
+		report := dnsbench.Report{StartedAt: startedAt, Config: config, Results: testResults}
+		resultText := formatResults(testResults)
+
+		ui.post(func() {
+			ui.testHistory = ui.retention.Apply(append(ui.testHistory, report), time.Now())
+			go ui.saveRun(report, ui.retention)
+
+			if runID != ui.runID {
+				// A newer run was started after this one was stopped.
+				return
+			}
+			ui.report = report
+			ui.results = resultText
+			if cancelled {
+				ui.status = "Testing stopped; partial results shown"
+			} else {
+				ui.status = "Testing completed"
+			}
+			ui.testing = false
+			if ui.monitor.active && !cancelled {
+				ui.monitorRun(report)
+			}
+		})
+	}()
+}
+
+// formatResults renders a run for the Test tab.
+func formatResults(testResults []dnsbench.TestResult) string {
+	var resultText string
+	resultText = "DNS Provider Latency Results:\n"
+	resultText += "----------------------------------------\n"
+	for _, result := range testResults {
+		if result.Cancelled && result.TestsDone == 0 {
+			resultText += fmt.Sprintf("%-20s (%s): Cancelled\n", result.Provider.Name, result.Provider.Address())
+			continue
+		}
+		if !result.Success {
+			resultText += fmt.Sprintf("%-20s (%s): Timeout or Error (%.0f%% loss)\n",
+				result.Provider.Name, result.Provider.Address(), result.Loss)
+		} else {
+			resultText += fmt.Sprintf("%-20s (%s): %v",
+				result.Provider.Name, result.Provider.Address(), result.Latency)
+			if result.FirstQueryLatency > 0 && result.ReusedLatency > 0 {
+				resultText += fmt.Sprintf(" (first %v, reused %v)", result.FirstQueryLatency, result.ReusedLatency)
+			}
+			if result.ZeroRTTLatency > 0 {
+				resultText += fmt.Sprintf(" (0-RTT %v, 1-RTT %v, handshake %v)",
+					result.ZeroRTTLatency, result.OneRTTLatency, result.HandshakeLatency)
+			}
+			resultText += fmt.Sprintf("\n    min %s  median %s  p90 %s  p95 %s  p99 %s  max %s  stddev %s  jitter %s  loss %.0f%%\n",
+				ms(result.Min), ms(result.Median), ms(result.P90), ms(result.P95), ms(result.P99),
+				ms(result.Max), ms(result.StdDev), ms(result.Jitter), result.Loss)
+			if result.UncachedStats != (dnsbench.Stats{}) {
+				resultText += fmt.Sprintf("    cached median %s | uncached median %s  p95 %s  loss %.0f%%\n",
+					ms(result.Median), ms(result.UncachedStats.Median), ms(result.UncachedStats.P95), result.UncachedStats.Loss)
+			}
+			for _, t := range dnsbench.QueryTypes {
+				if s, ok := result.TypeStats[t]; ok {
+					resultText += fmt.Sprintf("    %-5s median %s  p95 %s  max %s  loss %.0f%%\n", t, ms(s.Median), ms(s.P95), ms(s.Max), s.Loss)
+				}
+			}
+		}
+		if result.DNSSEC != nil {
+			resultText += fmt.Sprintf("    DNSSEC: %s\n", result.DNSSEC)
+		}
+		if result.ECS != nil {
+			resultText += fmt.Sprintf("    EDNS Client Subnet: %s\n", result.ECS)
+		}
+		if result.Identity != nil {
+			resultText += fmt.Sprintf("    Instance: %s\n", result.Identity)
+		}
+		if result.Cancelled {
+			resultText += fmt.Sprintf("    cancelled after %d of %d queries\n", result.TestsDone, result.TotalTests)
+		}
+		for _, f := range result.Findings {
+			resultText += fmt.Sprintf("    WARNING: %s\n", f)
+		}
+	}
+	if len(testResults) > 0 && testResults[0].ECS != nil {
+		resultText += formatAnswerGroups(testResults)
+	}
+	return resultText
+}
+
+// formatAnswerGroups lists, for every domain the providers did not agree
+// on, which of them returned addresses in which networks.
+func formatAnswerGroups(testResults []dnsbench.TestResult) string {
+	text := "\nAnswers that differ between providers:\n"
+	differing := false
+	for _, d := range dnsbench.CompareAnswers(testResults) {
+		if len(d.Groups) < 2 {
+			continue
+		}
+		differing = true
+		text += d.Domain + "\n"
+		for _, g := range d.Groups {
+			text += fmt.Sprintf("    %s: %s\n", strings.Join(g.Providers, ", "), strings.Join(g.Networks, " "))
+		}
+	}
+	if !differing {
+		return "\nEvery provider returned addresses in the same networks.\n"
+	}
+	return text
+}
+
+// stopTests cancels the running test and ends monitoring. The UI is ready
+// for a new run at once; the partial results are shown when the abandoned
+// queries return.
+func (ui *UI) stopTests() {
+	ui.monitor.stop()
+	if !ui.testing {
+		ui.status = "Monitoring stopped"
+		return
+	}
+	ui.cancel()
+	ui.pause.resume()
+	ui.testing = false
+	ui.status = "Testing stopped"
+}
+
+// pauser holds back a run's next queries while the user has paused the
+// test.
+type pauser struct {
+	mu      sync.Mutex
+	resumed chan struct{} // nil unless paused
+}
+
+func (p *pauser) pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed == nil {
+		p.resumed = make(chan struct{})
+	}
+}
+
+func (p *pauser) resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+	}
+}
+
+func (p *pauser) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed != nil
+}
+
+// wait blocks while paused, or until ctx is cancelled.
+func (p *pauser) wait(ctx context.Context) {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+	if resumed == nil {
+		return
+	}
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+	}
+}
+
+// edited reports whether ed was edited since the last frame.
+func edited(ed *widget.Editor) bool {
+	changed := false
+	for _, e := range ed.Events() {
+		if _, ok := e.(widget.ChangeEvent); ok {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// ms formats d in milliseconds with one decimal.
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// saveSettings queues a snapshot of the settings for saveLoop to write. A
+// snapshot still waiting to be written is replaced, since this one is newer.
+func (ui *UI) saveSettings() {
+	s := settings.Settings{
+		ExportFormat: ui.exportFormat.Value,
+		Providers:    append([]settings.Provider(nil), ui.customProviders...),
+		DomainSets:   append([]settings.DomainSet(nil), ui.domainSets...),
+		DomainSet:    ui.domainEditor.selected.Value,
+		Retention:    ui.retention,
+		Monitor:      ui.monitor.settings(),
+		History:      ui.unmigrated,
+	}
+	for _, p := range ui.providers {
+		if p.Selected.Value {
+			s.SelectedProviders = append(s.SelectedProviders, p.Name)
+		}
+	}
+	s.SetConfig(ui.config)
+
+	select {
+	case <-ui.saves:
+	default:
+	}
+	ui.saves <- s
+}
+
+// saveRun adds report to the history store and prunes it. Like saveLoop it
+// runs off the UI goroutine.
+func (ui *UI) saveRun(report dnsbench.Report, retention settings.Retention) {
+	if ui.store == nil {
+		return
+	}
+	err := ui.store.Add(report)
+	if err == nil {
+		_, err = ui.store.Prune(retention, time.Now())
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to save the run: %v", err)
+		ui.post(func() { ui.errorLog = append(ui.errorLog, msg) })
+	}
+}
+
+// saveLoop writes settings snapshots to disk off the UI goroutine.
+func (ui *UI) saveLoop() {
+	for s := range ui.saves {
+		if err := s.Save(); err != nil {
+			msg := fmt.Sprintf("Failed to save settings: %v", err)
+			ui.post(func() { ui.errorLog = append(ui.errorLog, msg) })
+		}
+	}
+}
+
+func (ui *UI) loadSettings() error {
+	s, err := settings.Load()
+	if err != nil {
+		return err
+	}
+
+	ui.config = s.Config()
+	store, err := history.Load(&s)
+	if store != nil {
+		ui.store = store
+		ui.testHistory = store.Runs()
+	}
+	if err != nil {
+		ui.errorLog = append(ui.errorLog, fmt.Sprintf("Failed to load the history: %v", err))
+	}
+	// Runs that could not be moved into the store stay in the settings
+	// file, so the next start can try again.
+	ui.unmigrated = s.History
+	ui.retention = s.Retention
+	ui.history.loadRetention(s.Retention)
+	ui.monitor.load(s.Monitor)
+	ui.customProviders = s.Providers
+	selected := make(map[string]bool)
+	for _, name := range s.SelectedProviders {
+		selected[name] = true
+	}
+	ui.rebuildProviders(selected)
+	ui.domainSets = s.DomainSets
+	ui.selectDomainSet(s.DomainSet)
+
+	// Update UI controls to match loaded settings
+	ui.useTCPCheckbox.Value = s.UseTCP
+	ui.useTLSCheckbox.Value = s.UseTLS
+	ui.useQUICCheckbox.Value = s.UseQUIC
+	ui.doqReconnect.Value = s.DoQReconnect
+	ui.useIPv6Checkbox.Value = s.UseIPv6
+	ui.parallelCheckbox.Value = s.ParallelTests
+	ui.dohPostCheckbox.Value = s.DoHMethod == http.MethodPost
+	if s.QueryType != "" {
+		ui.queryType.Value = s.QueryType
+	}
+	ui.uncachedCheckbox.Value = s.UncachedTests
+	ui.uncachedZone.SetText(s.UncachedZone)
+	ui.checkAnswers.Value = s.CheckAnswers
+	ui.checkDNSSEC.Value = s.CheckDNSSEC
+	ui.identifyResolver.Value = s.IdentifyResolver
+	ui.clientSubnet.SetText(s.ClientSubnet)
+	if s.ExportFormat != "" {
+		ui.exportFormat.Value = s.ExportFormat
+	}
+
+	return nil
+}
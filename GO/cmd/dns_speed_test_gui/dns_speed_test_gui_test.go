@@ -0,0 +1,228 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gioui.org/widget"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/dnsbench/dnstest"
+	"dns_speed_test/history"
+	"dns_speed_test/settings"
+)
+
+// newTestUI returns a UI with one selected provider answered by a local
+// dnstest server. The test goroutine stands in for the UI goroutine: it
+// runs the posted updates with drain.
+func newTestUI(t *testing.T, faults dnstest.Faults) (*UI, *dnstest.Server) {
+	t.Helper()
+	s, err := dnstest.NewServer("", faults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	addr := s.Addr()
+	ui := &UI{
+		updates: make(chan func(), 16),
+		providers: []*DNSProvider{{
+			DNSProvider: dnsbench.DNSProvider{Name: "local", IP: addr.Addr().String(), Port: int(addr.Port())},
+			Selected:    widget.Bool{Value: true},
+		}},
+		config: dnsbench.TestConfig{
+			TestsPerDomain: 5,
+			Timeout:        2 * time.Second,
+			Domains:        []string{"example.com", "example.net"},
+		},
+	}
+	t.Cleanup(func() {
+		if ui.testing {
+			ui.stopTests()
+		}
+	})
+	return ui, s
+}
+
+// drain runs posted updates until done reports true.
+func (ui *UI) drain(t *testing.T, done func() bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for !done() {
+		select {
+		case update := <-ui.updates:
+			update()
+		case <-timeout:
+			t.Fatalf("timed out; status %q", ui.status)
+		}
+	}
+}
+
+// settle runs the updates posted within d.
+func (ui *UI) settle(d time.Duration) {
+	timeout := time.After(d)
+	for {
+		select {
+		case update := <-ui.updates:
+			update()
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func TestRunCompletes(t *testing.T) {
+	ui, s := newTestUI(t, dnstest.Faults{})
+	ui.runTests()
+	if !ui.testing {
+		t.Fatalf("run not started: %s", ui.status)
+	}
+	ui.drain(t, func() bool { return !ui.testing })
+
+	if ui.status != "Testing completed" {
+		t.Errorf("status %q", ui.status)
+	}
+	total := ui.config.TotalTests()
+	if n := s.Queries(); n != total {
+		t.Errorf("server saw %d queries, want %d", n, total)
+	}
+	if len(ui.report.Results) != 1 || ui.report.Results[0].TestsDone != total {
+		t.Errorf("report %+v", ui.report.Results)
+	}
+	if len(ui.runQueries) != total || ui.progress() != 1 {
+		t.Errorf("%d queries shown, progress %v", len(ui.runQueries), ui.progress())
+	}
+	if len(ui.testHistory) != 1 {
+		t.Errorf("%d runs in the history", len(ui.testHistory))
+	}
+}
+
+func TestPauseHoldsBackRun(t *testing.T) {
+	ui, s := newTestUI(t, dnstest.Faults{Delay: 10 * time.Millisecond})
+	ui.runTests()
+	ui.drain(t, func() bool { return len(ui.runQueries) >= 2 })
+	ui.pause.pause()
+
+	// Let the queries already sent finish before counting.
+	ui.settle(100 * time.Millisecond)
+	sent := s.Queries()
+	ui.settle(200 * time.Millisecond)
+	if n := s.Queries(); n != sent {
+		t.Errorf("%d queries sent while paused", n-sent)
+	}
+	if !ui.testing || sent >= ui.config.TotalTests() {
+		t.Fatalf("run ended while paused: %s", ui.status)
+	}
+
+	ui.pause.resume()
+	ui.drain(t, func() bool { return !ui.testing })
+	if ui.status != "Testing completed" {
+		t.Errorf("status %q", ui.status)
+	}
+	if n := s.Queries(); n != ui.config.TotalTests() {
+		t.Errorf("server saw %d queries, want %d", n, ui.config.TotalTests())
+	}
+}
+
+func TestStopWhilePaused(t *testing.T) {
+	ui, s := newTestUI(t, dnstest.Faults{Delay: 10 * time.Millisecond})
+	ui.runTests()
+	ui.drain(t, func() bool { return len(ui.runQueries) >= 2 })
+	ui.pause.pause()
+	ui.settle(100 * time.Millisecond)
+
+	ui.stopTests()
+	if ui.testing || ui.status != "Testing stopped" {
+		t.Errorf("after stop: testing %v, status %q", ui.testing, ui.status)
+	}
+	if ui.pause.paused() {
+		t.Error("still paused after stop")
+	}
+	ui.drain(t, func() bool { return ui.status == "Testing stopped; partial results shown" })
+
+	if n := s.Queries(); n >= ui.config.TotalTests() {
+		t.Errorf("server saw all %d queries", n)
+	}
+	if len(ui.report.Results) != 1 || ui.report.Results[0].TestsDone >= ui.config.TotalTests() {
+		t.Errorf("report %+v", ui.report.Results)
+	}
+	if ui.results == "" {
+		t.Error("partial results not shown")
+	}
+}
+
+func TestStoppedRunDoesNotOverwriteNewerRun(t *testing.T) {
+	ui, _ := newTestUI(t, dnstest.Faults{Delay: 50 * time.Millisecond})
+	ui.runTests()
+	ui.stopTests()
+	ui.config.Timeout = time.Second
+	ui.runTests()
+	// Both runs reach the history, whichever returns first.
+	ui.drain(t, func() bool { return !ui.testing && len(ui.testHistory) == 2 })
+
+	if ui.status != "Testing completed" {
+		t.Errorf("status %q", ui.status)
+	}
+	if ui.report.Config.Timeout != time.Second {
+		t.Errorf("report is from the stopped run: %+v", ui.report.Config)
+	}
+}
+
+// TestSaveKeepsUnmigratedRuns saves the settings after loading a settings
+// file that still holds runs: they may only leave it once they are in the
+// history store.
+func TestSaveKeepsUnmigratedRuns(t *testing.T) {
+	tests := []struct {
+		name    string
+		history string // contents of the history file, if any
+		kept    int
+	}{
+		{"migrated", "", 0},
+		{"newer history file", `{"Schema":99}` + "\n", 1},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", dir)
+		t.Setenv("HOME", dir)
+		t.Setenv("AppData", dir)
+		path, err := settings.Path()
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := settings.New()
+		old.History = []dnsbench.Report{{StartedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}}
+		if err := old.Save(); err != nil {
+			t.Fatal(err)
+		}
+		if tt.history != "" {
+			historyPath, err := history.Path()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(historyPath, []byte(tt.history), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ui := &UI{saves: make(chan settings.Settings, 1)}
+		if err := ui.loadSettings(); err != nil {
+			t.Fatal(err)
+		}
+		ui.saveSettings()
+		if err := (<-ui.saves).Save(); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := settings.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.History) != tt.kept {
+			data, _ := os.ReadFile(path)
+			t.Errorf("%s: settings file holds %d runs, want %d:\n%s", tt.name, len(s.History), tt.kept, data)
+		}
+		if len(ui.testHistory)+len(s.History) != 1 {
+			t.Errorf("%s: %d runs in the history, %d in the settings file", tt.name, len(ui.testHistory), len(s.History))
+		}
+	}
+}
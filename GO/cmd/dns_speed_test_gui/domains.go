@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/settings"
+)
+
+// importLimit caps how many domains are taken from an imported list, so a
+// top-million CSV yields a set that can be tested in reasonable time.
+const importLimit = 100
+
+// domainSetEditor holds the state of the domain set section of the Config
+// tab.
+type domainSetEditor struct {
+	selected   widget.Enum
+	domains    widget.Editor
+	name       widget.Editor
+	add        widget.Clickable
+	remove     widget.Clickable
+	path       widget.Editor
+	importFile widget.Clickable
+	status     string
+}
+
+func (e *domainSetEditor) init() {
+	e.name.SingleLine = true
+	e.name.Submit = true
+	e.path.SingleLine = true
+	e.path.Submit = true
+}
+
+// selectDomainSet makes the named set the one runs use and loads it into
+// the editor. Unknown names select the first set.
+func (ui *UI) selectDomainSet(name string) {
+	i := 0
+	for j, set := range ui.domainSets {
+		if strings.EqualFold(set.Name, name) {
+			i = j
+		}
+	}
+	if len(ui.domainSets) == 0 {
+		return
+	}
+	set := ui.domainSets[i]
+	ui.domainEditor.selected.Value = set.Name
+	ui.domainEditor.domains.SetText(domainLines(set))
+	ui.config.Domains = set.Domains
+	ui.config.DomainTypes = set.Types
+}
+
+// domainLines formats a set for editing, one domain per line followed by
+// its record types, if it has any.
+func domainLines(set settings.DomainSet) string {
+	lines := make([]string, len(set.Domains))
+	for i, domain := range set.Domains {
+		lines[i] = strings.Join(append([]string{domain}, set.Types[domain]...), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// currentDomainSet is the index of the selected set in ui.domainSets.
+func (ui *UI) currentDomainSet() int {
+	for i, set := range ui.domainSets {
+		if set.Name == ui.domainEditor.selected.Value {
+			return i
+		}
+	}
+	return -1
+}
+
+// submitted reports whether Enter was pressed in ed.
+func submitted(ed *widget.Editor) bool {
+	submitted := false
+	for _, ev := range ed.Events() {
+		if _, ok := ev.(widget.SubmitEvent); ok {
+			submitted = true
+		}
+	}
+	return submitted
+}
+
+func (ui *UI) layoutDomainSets(gtx layout.Context) layout.Dimensions {
+	e := &ui.domainEditor
+	changed := false
+	if e.selected.Changed() {
+		ui.selectDomainSet(e.selected.Value)
+		e.status = ""
+		changed = true
+	}
+	for _, ev := range e.domains.Events() {
+		if _, ok := ev.(widget.ChangeEvent); ok {
+			if i := ui.currentDomainSet(); i >= 0 {
+				domains, types, _ := dnsbench.ReadDomainTypes(strings.NewReader(e.domains.Text()), 0)
+				ui.domainSets[i].Domains = domains
+				ui.domainSets[i].Types = types
+				ui.config.Domains = domains
+				ui.config.DomainTypes = types
+				changed = true
+			}
+		}
+	}
+	if e.add.Clicked() || submitted(&e.name) {
+		name := strings.TrimSpace(e.name.Text())
+		switch _, taken := (settings.Settings{DomainSets: ui.domainSets}).FindDomainSet(name); {
+		case name == "":
+			e.status = "Enter a name for the new domain set"
+		case taken:
+			e.status = fmt.Sprintf("There already is a domain set called %s", name)
+		default:
+			ui.domainSets = append(ui.domainSets, settings.DomainSet{Name: name})
+			ui.selectDomainSet(name)
+			e.name.SetText("")
+			e.status = ""
+			changed = true
+		}
+	}
+	if e.remove.Clicked() {
+		if i := ui.currentDomainSet(); i >= 0 && len(ui.domainSets) > 1 {
+			ui.domainSets = append(ui.domainSets[:i:i], ui.domainSets[i+1:]...)
+			ui.selectDomainSet(ui.domainSets[0].Name)
+			changed = true
+		} else {
+			e.status = "The last domain set cannot be deleted"
+		}
+	}
+	if e.importFile.Clicked() || submitted(&e.path) {
+		e.status = ui.importDomains(strings.TrimSpace(e.path.Text()))
+		changed = true
+	}
+	if changed {
+		ui.saveSettings()
+	}
+
+	var sets []layout.FlexChild
+	for _, set := range ui.domainSets {
+		set := set
+		sets = append(sets, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.RadioButton(ui.theme, &e.selected, set.Name, set.Name).Layout(gtx)
+		}))
+	}
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Body1(ui.theme, fmt.Sprintf("Domain set (%d domains):", len(ui.config.Domains))).Layout(gtx)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, sets...)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Editor(ui.theme, &e.domains, "One domain per line, optionally followed by record types (example.com MX TXT)").Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+					return material.Editor(ui.theme, &e.name, "Name of a new set").Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Button(ui.theme, &e.add, "New Set").Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Button(ui.theme, &e.remove, "Delete Set").Layout(gtx)
+				}),
+			)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+					return material.Editor(ui.theme, &e.path, "Text file or top-sites CSV to import").Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Button(ui.theme, &e.importFile, "Import").Layout(gtx)
+				}),
+			)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Body2(ui.theme, e.status).Layout(gtx)
+		}),
+	)
+}
+
+// importDomains adds the domains listed in the file at path to the selected
+// set and returns a status message.
+func (ui *UI) importDomains(path string) string {
+	i := ui.currentDomainSet()
+	if i < 0 {
+		return "Select a domain set to import into"
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Sprintf("Import failed: %v", err)
+	}
+	defer f.Close()
+	domains, types, err := dnsbench.ReadDomainTypes(f, importLimit)
+	if err != nil {
+		return fmt.Sprintf("Import failed: %v", err)
+	}
+
+	set := &ui.domainSets[i]
+	added := 0
+	for _, d := range domains {
+		known := false
+		for _, have := range set.Domains {
+			if have == d {
+				known = true
+				break
+			}
+		}
+		if !known {
+			set.Domains = append(set.Domains, d)
+			added++
+		}
+		if len(types[d]) > 0 {
+			if set.Types == nil {
+				set.Types = make(map[string][]string)
+			}
+			set.Types[d] = types[d]
+		}
+	}
+	ui.selectDomainSet(set.Name)
+	return fmt.Sprintf("Imported %d new domains into %s", added, set.Name)
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/settings"
+)
+
+// historyView holds the state of the History tab: the list of past runs,
+// the run opened in detail, the trend chart's provider and the retention
+// settings.
+type historyView struct {
+	list widget.List
+	// rows are keyed by runKey, so they stay with their run when older
+	// runs are dropped.
+	rows map[int64]*historyRow
+	// details is the key of the run shown in detail, or 0 for the list.
+	details   int64
+	back      widget.Clickable
+	trend     widget.Enum
+	trendList widget.List
+	maxRuns   widget.Editor
+	maxDays   widget.Editor
+	retain    widget.Clickable
+	status    string
+}
+
+type historyRow struct {
+	compare widget.Bool
+	details widget.Clickable
+	export  widget.Clickable
+}
+
+func (h *historyView) init() {
+	h.list.Axis = layout.Vertical
+	h.trendList.Axis = layout.Horizontal
+	h.rows = make(map[int64]*historyRow)
+	h.maxRuns.SingleLine = true
+	h.maxRuns.Submit = true
+	h.maxDays.SingleLine = true
+	h.maxDays.Submit = true
+}
+
+// loadRetention shows r in the retention fields, leaving a field empty
+// when there is no limit.
+func (h *historyView) loadRetention(r settings.Retention) {
+	h.maxRuns.SetText("")
+	if r.MaxRuns > 0 {
+		h.maxRuns.SetText(strconv.Itoa(r.MaxRuns))
+	}
+	h.maxDays.SetText("")
+	if r.MaxAge > 0 {
+		h.maxDays.SetText(strconv.Itoa(int(r.MaxAge / (24 * time.Hour))))
+	}
+}
+
+// retention parses the retention fields.
+func (h *historyView) retention() (settings.Retention, error) {
+	var r settings.Retention
+	for _, f := range []struct {
+		ed   *widget.Editor
+		name string
+		set  func(int)
+	}{
+		{&h.maxRuns, "number of runs", func(n int) { r.MaxRuns = n }},
+		{&h.maxDays, "number of days", func(n int) { r.MaxAge = time.Duration(n) * 24 * time.Hour }},
+	} {
+		text := strings.TrimSpace(f.ed.Text())
+		if text == "" {
+			continue
+		}
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 0 {
+			return r, fmt.Errorf("the %s to keep must be a whole number", f.name)
+		}
+		f.set(n)
+	}
+	return r, nil
+}
+
+// runKey identifies a run by its start time.
+func runKey(report dnsbench.Report) int64 {
+	return report.StartedAt.UnixNano()
+}
+
+func (h *historyView) row(report dnsbench.Report) *historyRow {
+	key := runKey(report)
+	row, ok := h.rows[key]
+	if !ok {
+		row = new(historyRow)
+		h.rows[key] = row
+	}
+	return row
+}
+
+// compared returns the runs ticked for comparison, oldest first.
+func (ui *UI) compared() []dnsbench.Report {
+	var runs []dnsbench.Report
+	for _, report := range ui.testHistory {
+		if ui.history.row(report).compare.Value {
+			runs = append(runs, report)
+		}
+	}
+	return runs
+}
+
+// historyProviders lists the names of every provider in the history, in
+// the order they first appear.
+func (ui *UI) historyProviders() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, report := range ui.testHistory {
+		for _, r := range report.Results {
+			if !seen[r.Provider.Name] {
+				seen[r.Provider.Name] = true
+				names = append(names, r.Provider.Name)
+			}
+		}
+	}
+	return names
+}
+
+func (ui *UI) layoutHistory(gtx layout.Context) layout.Dimensions {
+	h := &ui.history
+	for _, report := range ui.testHistory {
+		row := h.row(report)
+		if row.export.Clicked() {
+			go ui.exportResults(report, ui.exportFormat.Value)
+		}
+		if row.details.Clicked() {
+			h.details = runKey(report)
+			h.list.Position = layout.Position{}
+		}
+	}
+	if h.back.Clicked() {
+		h.details = 0
+	}
+	if h.retain.Clicked() || submitted(&h.maxRuns) || submitted(&h.maxDays) {
+		if r, err := h.retention(); err != nil {
+			h.status = err.Error()
+		} else {
+			before := len(ui.testHistory)
+			ui.retention = r
+			ui.testHistory = r.Apply(ui.testHistory, time.Now())
+			kept := make(map[int64]*historyRow)
+			for _, report := range ui.testHistory {
+				kept[runKey(report)] = h.row(report)
+			}
+			h.rows = kept
+			h.status = fmt.Sprintf("Removed %d runs", before-len(ui.testHistory))
+			ui.saveSettings()
+			if store := ui.store; store != nil {
+				go func() {
+					if _, err := store.Prune(r, time.Now()); err != nil {
+						msg := fmt.Sprintf("Failed to prune the history: %v", err)
+						ui.post(func() { ui.errorLog = append(ui.errorLog, msg) })
+					}
+				}()
+			}
+		}
+	}
+
+	var sections []layout.Widget
+	if h.details != 0 {
+		for _, report := range ui.testHistory {
+			if runKey(report) == h.details {
+				sections = ui.runDetails(report)
+			}
+		}
+	}
+	if sections == nil {
+		h.details = 0
+		sections = ui.historyOverview()
+	}
+	return layout.UniformInset(unit.Dp(10)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return material.List(ui.theme, &h.list).Layout(gtx, len(sections), func(gtx layout.Context, i int) layout.Dimensions {
+			return sections[i](gtx)
+		})
+	})
+}
+
+// historyOverview lists the sections of the History tab's main view.
+func (ui *UI) historyOverview() []layout.Widget {
+	h := &ui.history
+	body := func(text string) layout.Widget { return material.Body2(ui.theme, text).Layout }
+	heading := func(text string) layout.Widget {
+		return func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Top: unit.Dp(15), Bottom: unit.Dp(5)}.Layout(gtx, material.H6(ui.theme, text).Layout)
+		}
+	}
+
+	sections := []layout.Widget{
+		heading("Test History"),
+		func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(material.Body1(ui.theme, "Keep the last ").Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					gtx.Constraints.Max.X = gtx.Dp(60)
+					return material.Editor(ui.theme, &h.maxRuns, "all").Layout(gtx)
+				}),
+				layout.Rigid(material.Body1(ui.theme, " runs, from the last ").Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					gtx.Constraints.Max.X = gtx.Dp(60)
+					return material.Editor(ui.theme, &h.maxDays, "any").Layout(gtx)
+				}),
+				layout.Rigid(material.Body1(ui.theme, " days ").Layout),
+				layout.Rigid(material.Button(ui.theme, &h.retain, "Apply").Layout),
+			)
+		},
+		body(h.status),
+	}
+	if len(ui.testHistory) == 0 {
+		return append(sections, body("No runs yet."))
+	}
+
+	switch runs := ui.compared(); len(runs) {
+	case 0:
+	case 2:
+		sections = append(sections, heading(fmt.Sprintf("Comparison: %s → %s",
+			runs[0].StartedAt.Format("2006-01-02 15:04"), runs[1].StartedAt.Format("2006-01-02 15:04"))))
+		for _, d := range dnsbench.Compare(runs[0], runs[1]) {
+			sections = append(sections, body(formatDelta(d)))
+		}
+	default:
+		sections = append(sections, body("Tick two runs to compare them."))
+	}
+
+	providers := ui.historyProviders()
+	if h.trend.Value == "" && len(providers) > 0 {
+		h.trend.Value = providers[0]
+	}
+	trend := dnsbench.Trend(ui.testHistory, h.trend.Value)
+	sections = append(sections,
+		heading("Median latency trend"),
+		func(gtx layout.Context) layout.Dimensions {
+			return material.List(ui.theme, &h.trendList).Layout(gtx, len(providers), func(gtx layout.Context, i int) layout.Dimensions {
+				return material.RadioButton(ui.theme, &h.trend, providers[i], providers[i]).Layout(gtx)
+			})
+		},
+		func(gtx layout.Context) layout.Dimensions {
+			return layoutTrend(gtx, ui.theme, trend, chartPalette[0])
+		},
+		body(formatInstanceChanges(trend)),
+		heading("Runs"),
+	)
+
+	for i := len(ui.testHistory) - 1; i >= 0; i-- {
+		report := ui.testHistory[i]
+		row := h.row(report)
+		summary := fmt.Sprintf("%s, %d providers", report.StartedAt.Format("2006-01-02 15:04:05"), len(report.Results))
+		if len(report.Results) > 0 && report.Results[0].Success {
+			fastest := report.Results[0]
+			summary += fmt.Sprintf(", fastest %s (%s)", fastest.Provider.Name, ms(fastest.Latency))
+		}
+		sections = append(sections, func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(material.CheckBox(ui.theme, &row.compare, "").Layout),
+				layout.Flexed(1, material.Body1(ui.theme, summary).Layout),
+				layout.Rigid(material.Button(ui.theme, &row.details, "Details").Layout),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+				layout.Rigid(material.Button(ui.theme, &row.export, "Export").Layout),
+			)
+		})
+	}
+	return sections
+}
+
+// runDetails lists the sections of the detail view of one run: its
+// configuration, charts and every query.
+func (ui *UI) runDetails(report dnsbench.Report) []layout.Widget {
+	h := &ui.history
+	body := func(text string) layout.Widget { return material.Body2(ui.theme, text).Layout }
+	heading := func(text string) layout.Widget {
+		return func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Top: unit.Dp(15), Bottom: unit.Dp(5)}.Layout(gtx, material.H6(ui.theme, text).Layout)
+		}
+	}
+	var providers []dnsbench.DNSProvider
+	for _, r := range report.Results {
+		providers = append(providers, r.Provider)
+	}
+	colors := chartColors(providers)
+	row := h.row(report)
+
+	sections := []layout.Widget{
+		func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(material.Button(ui.theme, &h.back, "Back").Layout),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+				layout.Rigid(material.Button(ui.theme, &row.export, "Export").Layout),
+			)
+		},
+		heading("Run of " + report.StartedAt.Format("2006-01-02 15:04:05")),
+		body(formatConfig(report.Config)),
+		heading("Median latency"),
+		func(gtx layout.Context) layout.Dimensions {
+			return layoutBarChart(gtx, ui.theme, report.Results, colors)
+		},
+		heading("Latency distribution"),
+		func(gtx layout.Context) layout.Dimensions {
+			return layoutBoxPlot(gtx, ui.theme, report.Results, colors)
+		},
+		heading("Results"),
+		body(formatResults(report.Results)),
+		heading("Queries"),
+	}
+	for _, r := range report.Results {
+		for _, q := range r.Queries {
+			sections = append(sections, body(formatQuery(q)))
+		}
+	}
+	return sections
+}
+
+// formatConfig describes how a run was configured.
+func formatConfig(c dnsbench.TestConfig) string {
+	transport := "UDP"
+	switch {
+	case c.UseQUIC:
+		transport = "DNS-over-QUIC"
+	case c.UseTLS:
+		transport = "DNS-over-TLS"
+	case c.UseTCP:
+		transport = "TCP"
+	}
+	family := "IPv4"
+	if c.UseIPv6 {
+		family = "IPv6"
+	}
+	mode := "sequential"
+	if c.ParallelTests {
+		mode = "parallel"
+	}
+	queryType := c.QueryType
+	if queryType == "" {
+		queryType = "A"
+	}
+	lines := []string{
+		fmt.Sprintf("%d queries for each of %d domains: %s", c.TestsPerDomain, len(c.Domains), strings.Join(c.Domains, ", ")),
+		fmt.Sprintf("%s records over %s and %s, %s, timeout %v", queryType, transport, family, mode, c.Timeout),
+	}
+	if len(c.DomainTypes) > 0 {
+		var types []string
+		for _, domain := range c.Domains {
+			if t := c.DomainTypes[domain]; len(t) > 0 {
+				types = append(types, domain+" "+strings.Join(t, " "))
+			}
+		}
+		lines = append(lines, "Per-domain types: "+strings.Join(types, ", "))
+	}
+	if c.UncachedTests {
+		zone := c.UncachedZone
+		if zone == "" {
+			zone = "each test domain"
+		}
+		lines = append(lines, "Uncached queries under "+zone)
+	}
+	if c.CheckDNSSEC {
+		lines = append(lines, "DNSSEC validation checked")
+	}
+	if c.IdentifyResolver {
+		lines = append(lines, "Resolver instance identified")
+	}
+	if c.ClientSubnet != "" {
+		lines = append(lines, "Client subnet "+c.ClientSubnet+" sent with EDNS Client Subnet")
+	}
+	if c.CheckAnswers {
+		lines = append(lines, "Answers checked against the other providers")
+	}
+	if c.DoHMethod != "" {
+		lines = append(lines, "DoH method "+c.DoHMethod)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatInstanceChanges lists the runs in which the provider was answered
+// by a different instance than in the run before, so latency changes can
+// be matched with anycast site changes.
+func formatInstanceChanges(points []dnsbench.TrendPoint) string {
+	var lines []string
+	last := ""
+	for _, p := range points {
+		if p.Instance == "" {
+			continue
+		}
+		if p.Instance != last {
+			line := fmt.Sprintf("%s  instance %s", p.StartedAt.Format("2006-01-02 15:04"), p.Instance)
+			if p.Success {
+				line += "  median " + ms(p.Median)
+			}
+			lines = append(lines, line)
+		}
+		last = p.Instance
+	}
+	if len(lines) == 0 {
+		return "No instance identifiers recorded."
+	}
+	return "Instance changes:\n" + strings.Join(lines, "\n")
+}
+
+// formatQuery describes one query in a line.
+func formatQuery(q dnsbench.QueryResult) string {
+	outcome := q.Rcode
+	if !q.Success {
+		outcome = "failed: " + q.Error
+	}
+	line := fmt.Sprintf("%s  %s %s %s via %s  %s  %s", q.TimeStamp.Format("15:04:05.000"),
+		q.Provider, q.Domain, q.QueryType, q.Transport, ms(q.Latency), outcome)
+	if q.ECSEchoed {
+		line += fmt.Sprintf("  ECS scope /%d", q.ECSScope)
+	}
+	if len(q.CNAMEs) > 0 {
+		line += "  via " + strings.Join(q.CNAMEs, " > ")
+	}
+	if len(q.Addrs) > 0 {
+		line += "  " + strings.Join(q.Addrs, ", ")
+	}
+	if q.Uncached {
+		line += "  (uncached)"
+	}
+	return line
+}
+
+// formatDelta describes how a provider changed between two runs.
+func formatDelta(d dnsbench.Delta) string {
+	switch {
+	case !d.InBefore:
+		return fmt.Sprintf("%-20s only in the second run", d.Provider)
+	case !d.InAfter:
+		return fmt.Sprintf("%-20s only in the first run", d.Provider)
+	case !d.Comparable():
+		return fmt.Sprintf("%-20s failed in at least one run (loss %.0f%% → %.0f%%)", d.Provider, d.Before.Loss, d.After.Loss)
+	}
+	change := ""
+	if d.Before.Median > 0 {
+		change = fmt.Sprintf(" (%+.0f%%)", 100*float64(d.Median)/float64(d.Before.Median))
+	}
+	return fmt.Sprintf("%-20s median %s → %s, %s%s; p95 %s; loss %+.0f points", d.Provider,
+		ms(d.Before.Median), ms(d.After.Median), signedMs(d.Median), change, signedMs(d.P95), d.Loss)
+}
+
+// signedMs formats d like ms, with a sign.
+func signedMs(d time.Duration) string {
+	if d >= 0 {
+		return "+" + ms(d)
+	}
+	return "-" + ms(-d)
+}
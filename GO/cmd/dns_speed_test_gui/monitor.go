@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/monitor"
+	"dns_speed_test/settings"
+)
+
+// maxAlertsShown is how many of the latest alerts the Test tab lists.
+const maxAlertsShown = 20
+
+// monitorView holds the monitor controls of the Test tab and, while
+// monitoring, the schedule, the baseline of every provider and the alerts
+// raised so far.
+type monitorView struct {
+	enabled  widget.Bool
+	schedule widget.Editor
+	desktop  widget.Bool
+	// active is set from the first monitored run until Stop is pressed.
+	active   bool
+	sched    monitor.Schedule
+	detector *monitor.Detector
+	// timer starts the next run at next.
+	timer  *time.Timer
+	next   time.Time
+	alerts []monitor.Alert
+}
+
+func (m *monitorView) init() {
+	m.schedule.SingleLine = true
+}
+
+func (m *monitorView) load(s settings.Monitor) {
+	m.schedule.SetText(s.Schedule)
+	m.desktop.Value = s.DesktopAlerts
+}
+
+func (m *monitorView) settings() settings.Monitor {
+	return settings.Monitor{Schedule: strings.TrimSpace(m.schedule.Text()), DesktopAlerts: m.desktop.Value}
+}
+
+// changed reports whether a saved control was changed since the last
+// frame.
+func (m *monitorView) changed() bool {
+	changed := m.desktop.Changed()
+	for _, e := range m.schedule.Events() {
+		if _, ok := e.(widget.ChangeEvent); ok {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// stop ends monitoring and cancels the next run. The alerts stay on show.
+func (m *monitorView) stop() {
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	m.active = false
+	m.next = time.Time{}
+}
+
+// startMonitor begins monitoring with a fresh baseline. The caller starts
+// the first run.
+func (ui *UI) startMonitor() bool {
+	m := &ui.monitor
+	sched, err := monitor.ParseSchedule(m.schedule.Text())
+	if err != nil {
+		ui.status = fmt.Sprintf("Invalid schedule: %v", err)
+		return false
+	}
+	m.stop()
+	m.active = true
+	m.sched = sched
+	m.detector = monitor.NewDetector(monitor.DefaultThresholds())
+	m.alerts = nil
+	return true
+}
+
+// monitorRun checks a finished monitored run for degradations and
+// schedules the next run. Starts missed while the run overran are skipped.
+func (ui *UI) monitorRun(report dnsbench.Report) {
+	m := &ui.monitor
+	alerts := m.detector.Observe(report)
+	m.alerts = append(m.alerts, alerts...)
+	if m.desktop.Value && len(alerts) > 0 {
+		go func() {
+			for _, a := range alerts {
+				if err := (monitor.Desktop{}).Notify(context.Background(), a); err != nil {
+					msg := fmt.Sprintf("Failed to show an alert: %v", err)
+					ui.post(func() { ui.errorLog = append(ui.errorLog, msg) })
+					return
+				}
+			}
+		}()
+	}
+
+	now := time.Now()
+	next := report.StartedAt
+	for !next.After(now) {
+		if next = m.sched.Next(next); next.IsZero() {
+			m.stop()
+			ui.status = "Monitoring finished: the schedule has no more runs"
+			return
+		}
+	}
+	m.next = next
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(next), func() {
+		ui.post(func() {
+			if m.timer != timer {
+				// Monitoring was stopped or restarted meanwhile.
+				return
+			}
+			m.timer = nil
+			ui.runTests()
+			if !ui.testing {
+				// runTests has set the status to say why.
+				m.stop()
+			}
+		})
+	})
+	m.timer = timer
+	ui.status = fmt.Sprintf("Monitoring %v; next run at %s", m.sched, next.Format("15:04:05"))
+}
+
+func (ui *UI) layoutMonitorControls(gtx layout.Context) layout.Dimensions {
+	m := &ui.monitor
+	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+		layout.Rigid(material.CheckBox(ui.theme, &m.enabled, "Monitor, repeating the test").Layout),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Max.X = gtx.Dp(160)
+			return material.Editor(ui.theme, &m.schedule, "5m or */15 * * * *").Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+		layout.Rigid(material.CheckBox(ui.theme, &m.desktop, "Desktop alerts").Layout),
+	)
+}
+
+// monitorSections shows each provider's baseline and the latest alerts,
+// newest first, once monitoring has started.
+func (ui *UI) monitorSections(heading func(string) layout.Widget) []layout.Widget {
+	m := &ui.monitor
+	if m.detector == nil {
+		return nil
+	}
+	var b strings.Builder
+	for _, r := range m.detector.Rolling() {
+		state := "ok"
+		if r.Degraded {
+			state = "DEGRADED"
+		}
+		fmt.Fprintf(&b, "%-20s %-8s baseline %s, %.0f%% failed over %d runs; last %s, %.0f%% failed\n",
+			r.Provider, state, ms(r.Median), r.Loss, r.Runs, ms(r.LastMedian), r.LastLoss)
+	}
+	sections := []layout.Widget{heading("Monitoring"), material.Body2(ui.theme, b.String()).Layout}
+	for i := len(m.alerts) - 1; i >= 0 && i >= len(m.alerts)-maxAlertsShown; i-- {
+		a := m.alerts[i]
+		label := material.Body2(ui.theme, a.Time.Format("2006-01-02 15:04:05")+"  "+a.String())
+		if a.Kind != monitor.AlertRecovered {
+			label.Color = failColor
+		}
+		sections = append(sections, label.Layout)
+	}
+	return sections
+}
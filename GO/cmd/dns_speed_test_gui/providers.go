@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/settings"
+)
+
+// providerEditor holds the state of the Providers tab, where users add,
+// edit, enable and delete their own resolvers.
+type providerEditor struct {
+	rows []providerRow
+	// editing is the index of the provider loaded into the form, or -1
+	// when the form adds a new one.
+	editing    int
+	name       widget.Editor
+	ip         widget.Editor
+	ipv6       widget.Editor
+	port       widget.Editor
+	url        widget.Editor
+	serverName widget.Editor
+	group      widget.Editor
+	transport  widget.Enum
+	save       widget.Clickable
+	clear      widget.Clickable
+	err        string
+	list       widget.List
+}
+
+type providerRow struct {
+	enabled widget.Bool
+	edit    widget.Clickable
+	remove  widget.Clickable
+}
+
+var transportChoices = []struct {
+	value dnsbench.Transport
+	label string
+}{
+	{"", "Test setting"},
+	{dnsbench.TransportUDP, "UDP"},
+	{dnsbench.TransportTCP, "TCP"},
+	{dnsbench.TransportDoT, "DoT"},
+	{dnsbench.TransportDoQ, "DoQ"},
+	{dnsbench.TransportDoH, "DoH"},
+}
+
+func (e *providerEditor) init() {
+	e.editing = -1
+	e.list.Axis = layout.Vertical
+	for _, ed := range []*widget.Editor{&e.name, &e.ip, &e.ipv6, &e.port, &e.url, &e.serverName, &e.group} {
+		ed.SingleLine = true
+		ed.Submit = true
+	}
+}
+
+// load fills the form with p, or empties it for a new provider when i is -1.
+func (e *providerEditor) load(p settings.Provider, i int) {
+	e.editing = i
+	e.err = ""
+	e.name.SetText(p.Name)
+	e.ip.SetText(p.IP)
+	e.ipv6.SetText(p.IPv6)
+	e.port.SetText("")
+	if p.Port != 0 {
+		e.port.SetText(strconv.Itoa(p.Port))
+	}
+	e.url.SetText(p.URL)
+	e.serverName.SetText(p.ServerName)
+	e.group.SetText(p.Group)
+	e.transport.Value = string(p.Transport)
+}
+
+// provider is the provider described by the form.
+func (e *providerEditor) provider() (settings.Provider, error) {
+	p := settings.Provider{
+		DNSProvider: dnsbench.DNSProvider{
+			Name:       strings.TrimSpace(e.name.Text()),
+			IP:         strings.TrimSpace(e.ip.Text()),
+			IPv6:       strings.TrimSpace(e.ipv6.Text()),
+			URL:        strings.TrimSpace(e.url.Text()),
+			ServerName: strings.TrimSpace(e.serverName.Text()),
+			Transport:  dnsbench.Transport(e.transport.Value),
+		},
+		Group:   strings.TrimSpace(e.group.Text()),
+		Enabled: true,
+	}
+	if p.Group == "" {
+		p.Group = settings.DefaultGroup
+	}
+	if port := strings.TrimSpace(e.port.Text()); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return p, fmt.Errorf("port %q is not a number", port)
+		}
+		p.Port = n
+	}
+	return p, nil
+}
+
+// submitted reports whether Enter was pressed in any of the form's fields.
+func (e *providerEditor) submitted() bool {
+	found := false
+	for _, ed := range []*widget.Editor{&e.name, &e.ip, &e.ipv6, &e.port, &e.url, &e.serverName, &e.group} {
+		if submitted(ed) {
+			found = true
+		}
+	}
+	return found
+}
+
+// rebuildProviders refreshes the Test tab's provider list from the built-in
+// and enabled custom providers, keeping the selection of those that remain.
+func (ui *UI) rebuildProviders(selected map[string]bool) {
+	if selected == nil {
+		selected = make(map[string]bool)
+		for _, p := range ui.providers {
+			if p.Selected.Value {
+				selected[p.Name] = true
+			}
+		}
+	}
+
+	ui.providers = nil
+	for _, p := range dnsbench.DefaultProviders {
+		ui.providers = append(ui.providers, &DNSProvider{DNSProvider: p, Group: settings.BuiltinGroup})
+	}
+	for _, p := range ui.customProviders {
+		if p.Enabled {
+			ui.providers = append(ui.providers, &DNSProvider{DNSProvider: p.DNSProvider, Group: p.Group})
+		}
+	}
+	for _, p := range ui.providers {
+		p.Selected.Value = selected[p.Name]
+	}
+
+	if len(ui.editor.rows) != len(ui.customProviders) {
+		ui.editor.rows = make([]providerRow, len(ui.customProviders))
+	}
+	for i, p := range ui.customProviders {
+		ui.editor.rows[i].enabled.Value = p.Enabled
+	}
+}
+
+func (ui *UI) layoutProviders(gtx layout.Context) layout.Dimensions {
+	e := &ui.editor
+	changed := false
+	for i := range e.rows {
+		row := &e.rows[i]
+		if row.enabled.Changed() {
+			ui.customProviders[i].Enabled = row.enabled.Value
+			changed = true
+		}
+		if row.edit.Clicked() {
+			e.load(ui.customProviders[i], i)
+		}
+		if row.remove.Clicked() {
+			ui.customProviders = append(ui.customProviders[:i:i], ui.customProviders[i+1:]...)
+			if e.editing == i {
+				e.load(settings.Provider{}, -1)
+			} else if e.editing > i {
+				e.editing--
+			}
+			changed = true
+			break
+		}
+	}
+	if e.clear.Clicked() {
+		e.load(settings.Provider{}, -1)
+	}
+	if e.save.Clicked() || e.submitted() {
+		p, err := e.provider()
+		if err == nil {
+			err = settings.Settings{Providers: ui.customProviders}.CheckProvider(p, e.editing)
+		}
+		if err != nil {
+			e.err = err.Error()
+		} else {
+			if e.editing >= 0 {
+				p.Enabled = ui.customProviders[e.editing].Enabled
+				ui.customProviders[e.editing] = p
+			} else {
+				ui.customProviders = append(ui.customProviders, p)
+			}
+			e.load(settings.Provider{}, -1)
+			changed = true
+		}
+	}
+	if changed {
+		ui.rebuildProviders(nil)
+		ui.saveSettings()
+	}
+
+	field := func(ed *widget.Editor, label string) layout.FlexChild {
+		return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Editor(ui.theme, ed, label).Layout(gtx)
+		})
+	}
+
+	title := "Add provider"
+	if e.editing >= 0 {
+		title = "Edit " + ui.customProviders[e.editing].Name
+	}
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.H6(ui.theme, "Custom Providers").Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+	}
+	if len(ui.customProviders) == 0 {
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Body2(ui.theme, "No custom providers yet.").Layout(gtx)
+		}))
+	}
+	for i := range ui.customProviders {
+		i := i
+		p := ui.customProviders[i]
+		row := &e.rows[i]
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			transport := string(p.Transport)
+			if transport == "" {
+				transport = "test setting"
+			}
+			label := fmt.Sprintf("%s [%s] %s", p.Name, p.Group, p.Address())
+			if p.IPv6 != "" && p.IP != "" {
+				label += ", " + p.IPv6
+			}
+			if p.Port != 0 {
+				label += fmt.Sprintf(" port %d", p.Port)
+			}
+			label += " (" + transport + ")"
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.CheckBox(ui.theme, &row.enabled, label).Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Button(ui.theme, &row.edit, "Edit").Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Button(ui.theme, &row.remove, "Delete").Layout(gtx)
+				}),
+			)
+		}))
+	}
+	children = append(children,
+		layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Body1(ui.theme, title).Layout(gtx)
+		}),
+		field(&e.name, "Name"),
+		field(&e.ip, "IPv4 address"),
+		field(&e.ipv6, "IPv6 address"),
+		field(&e.port, "Port (default: 53, or 853 for DoT/DoQ)"),
+		field(&e.url, "DoH URL (https://...)"),
+		field(&e.serverName, "TLS server name (default: the IP address)"),
+		field(&e.group, "Group (default: "+settings.DefaultGroup+")"),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			var choices []layout.FlexChild
+			for _, c := range transportChoices {
+				c := c
+				choices = append(choices, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.RadioButton(ui.theme, &e.transport, string(c.value), c.label).Layout(gtx)
+				}))
+			}
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, choices...)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			label := "Add"
+			if e.editing >= 0 {
+				label = "Save"
+			}
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Button(ui.theme, &e.save, label).Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Button(ui.theme, &e.clear, "Clear").Layout(gtx)
+				}),
+			)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Body2(ui.theme, e.err).Layout(gtx)
+		}),
+	)
+
+	return material.List(ui.theme, &e.list).Layout(gtx, 1, func(gtx layout.Context, _ int) layout.Dimensions {
+		return layout.UniformInset(unit.Dp(10)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+		})
+	})
+}
@@ -0,0 +1,198 @@
+package dnsbench
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Kinds of Finding.
+const (
+	FindingWrongAnswer      = "wrong answer"
+	FindingNXDOMAINRedirect = "NXDOMAIN redirect"
+)
+
+// Finding is a sign that a provider tampers with answers.
+type Finding struct {
+	Kind   string
+	Domain string
+	Detail string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s for %s: %s", f.Kind, f.Domain, f.Detail)
+}
+
+// checkExpected adds a finding for every domain where the provider returned
+// an address outside TestConfig.ExpectedAnswers.
+func checkExpected(result *TestResult, expected map[string][]string) {
+	flagged := make(map[string]bool)
+	for _, q := range result.Queries {
+		want, ok := expected[q.Domain]
+		if !ok || !q.Success || flagged[q.Domain] {
+			continue
+		}
+		if unexpected := unexpectedAddrs(q, want); len(unexpected) > 0 {
+			flagged[q.Domain] = true
+			result.Findings = append(result.Findings, Finding{
+				Kind:   FindingWrongAnswer,
+				Domain: q.Domain,
+				Detail: "returned unexpected " + strings.Join(unexpected, ", "),
+			})
+		}
+	}
+}
+
+// unexpectedAddrs reports the addresses in q that are not covered by
+// expected, a list of IP addresses and CIDR prefixes.
+func unexpectedAddrs(q QueryResult, expected []string) []string {
+	var prefixes []netip.Prefix
+	for _, e := range expected {
+		if p, err := netip.ParsePrefix(e); err == nil {
+			prefixes = append(prefixes, p.Masked())
+		} else if a, err := netip.ParseAddr(e); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(a, a.BitLen()))
+		}
+	}
+
+	var unexpected []string
+	for _, s := range q.Addrs {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			continue
+		}
+		ok := false
+		for _, p := range prefixes {
+			if p.Contains(addr) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			unexpected = append(unexpected, s)
+		}
+	}
+	return unexpected
+}
+
+// probeNXDOMAIN asks for a random name that cannot exist. An honest
+// resolver answers NXDOMAIN; one that returns addresses is redirecting
+// failed lookups, typically to a search or advertising page.
+func probeNXDOMAIN(ctx context.Context, c exchanger, provider DNSProvider, transport Transport) *Finding {
+	name := randomName("com")
+	q := QueryResult{Provider: provider.Name, Domain: name, Transport: transport}
+	if err := lookup(ctx, c, name, dnsmessage.TypeA, &q); err != nil || q.Rcode != "NOERROR" || len(q.Addrs) == 0 {
+		return nil
+	}
+	return &Finding{
+		Kind:   FindingNXDOMAINRedirect,
+		Domain: name,
+		Detail: "nonexistent name resolved to " + strings.Join(q.Addrs, ", "),
+	}
+}
+
+// checkConsensus compares the addresses each provider returned for every
+// domain. Answers often differ between resolvers because of CDNs, so
+// addresses are compared by network (/24 for IPv4, /48 for IPv6) and a
+// provider is only flagged when at least two others agree with each other
+// and none of them returned any of its networks.
+func checkConsensus(results []TestResult, expected map[string][]string) {
+	// networks[domain][i] is the set of networks provider i returned.
+	networks := make(map[string][]map[netip.Prefix]bool)
+	answers := make(map[string][]map[string]bool)
+	for i, r := range results {
+		for _, q := range r.Queries {
+			if q.Uncached || !q.Success || len(q.Addrs) == 0 {
+				continue
+			}
+			if _, ok := expected[q.Domain]; ok {
+				continue
+			}
+			if networks[q.Domain] == nil {
+				networks[q.Domain] = make([]map[netip.Prefix]bool, len(results))
+				answers[q.Domain] = make([]map[string]bool, len(results))
+			}
+			if networks[q.Domain][i] == nil {
+				networks[q.Domain][i] = make(map[netip.Prefix]bool)
+				answers[q.Domain][i] = make(map[string]bool)
+			}
+			for _, s := range q.Addrs {
+				if addr, err := netip.ParseAddr(s); err == nil {
+					networks[q.Domain][i][network(addr)] = true
+					answers[q.Domain][i][s] = true
+				}
+			}
+		}
+	}
+
+	var domains []string
+	for domain := range networks {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		sets := networks[domain]
+		for i, own := range sets {
+			if own == nil || !othersAgree(sets, i) {
+				continue
+			}
+			shared := false
+			for j, other := range sets {
+				if j == i || other == nil {
+					continue
+				}
+				for n := range own {
+					if other[n] {
+						shared = true
+						break
+					}
+				}
+			}
+			if shared {
+				continue
+			}
+			var addrs []string
+			for a := range answers[domain][i] {
+				addrs = append(addrs, a)
+			}
+			sort.Strings(addrs)
+			results[i].Findings = append(results[i].Findings, Finding{
+				Kind:   FindingWrongAnswer,
+				Domain: domain,
+				Detail: "returned " + strings.Join(addrs, ", ") + ", which no other provider did",
+			})
+		}
+	}
+}
+
+// othersAgree reports whether two providers other than skip returned an
+// overlapping set of networks.
+func othersAgree(sets []map[netip.Prefix]bool, skip int) bool {
+	for a := range sets {
+		for b := a + 1; b < len(sets); b++ {
+			if a == skip || b == skip || sets[a] == nil || sets[b] == nil {
+				continue
+			}
+			for n := range sets[a] {
+				if sets[b][n] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func network(addr netip.Addr) netip.Prefix {
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	p, _ := addr.Prefix(bits)
+	return p
+}
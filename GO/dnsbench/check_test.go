@@ -0,0 +1,98 @@
+package dnsbench
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench/dnstest"
+)
+
+// newResolver starts a server that answers the test domains with addr and
+// everything else with NXDOMAIN, unless redirect is set.
+func newResolver(t *testing.T, name, addr string, redirect bool) DNSProvider {
+	t.Helper()
+	zone := "example.com"
+	if redirect {
+		zone = ""
+	}
+	provider, s := newMockServer(t, name, zone, dnstest.Faults{})
+	s.SetAddrs(netip.MustParseAddr(addr), dnstest.AddrAAAA)
+	return provider
+}
+
+func checkConfig() TestConfig {
+	return TestConfig{
+		TestsPerDomain: 1,
+		Timeout:        2 * time.Second,
+		Domains:        []string{"www.example.com", "cdn.example.com"},
+		CheckAnswers:   true,
+	}
+}
+
+func TestCheckAnswersFlagsHijacker(t *testing.T) {
+	providers := []DNSProvider{
+		newResolver(t, "honest 1", "192.0.2.1", false),
+		newResolver(t, "honest 2", "192.0.2.2", false),
+		newResolver(t, "honest 3", "192.0.2.1", false),
+		newResolver(t, "hijacker", "203.0.113.66", true),
+	}
+
+	results := Run(context.Background(), providers, checkConfig(), nil)
+	for _, r := range results[:3] {
+		if len(r.Findings) != 0 {
+			t.Errorf("%s: unexpected findings %v", r.Provider.Name, r.Findings)
+		}
+	}
+
+	kinds := make(map[string]int)
+	for _, f := range results[3].Findings {
+		kinds[f.Kind]++
+		if f.Kind == FindingWrongAnswer && !strings.Contains(f.Detail, "203.0.113.66") {
+			t.Errorf("finding does not name the wrong address: %v", f)
+		}
+	}
+	if kinds[FindingWrongAnswer] != 2 || kinds[FindingNXDOMAINRedirect] != 1 {
+		t.Errorf("hijacker findings = %v, want 2 wrong answers and 1 NXDOMAIN redirect", results[3].Findings)
+	}
+}
+
+func TestCheckAnswersToleratesDisagreement(t *testing.T) {
+	// With no two providers agreeing there is no consensus to compare with,
+	// as happens with CDNs that hand every resolver a different edge.
+	providers := []DNSProvider{
+		newResolver(t, "a", "192.0.2.1", false),
+		newResolver(t, "b", "198.51.100.1", false),
+		newResolver(t, "c", "203.0.113.1", false),
+	}
+
+	for _, r := range Run(context.Background(), providers, checkConfig(), nil) {
+		if len(r.Findings) != 0 {
+			t.Errorf("%s: unexpected findings %v", r.Provider.Name, r.Findings)
+		}
+	}
+}
+
+func TestExpectedAnswers(t *testing.T) {
+	providers := []DNSProvider{
+		newResolver(t, "good", "192.0.2.7", false),
+		newResolver(t, "bad", "198.51.100.7", false),
+	}
+	config := checkConfig()
+	config.CheckAnswers = false
+	config.ExpectedAnswers = map[string][]string{
+		"www.example.com": {"192.0.2.0/24"},
+		"cdn.example.com": {"198.51.100.7", "192.0.2.7"},
+	}
+
+	results := Run(context.Background(), providers, config, nil)
+	if len(results[0].Findings) != 0 {
+		t.Errorf("good: unexpected findings %v", results[0].Findings)
+	}
+	want := []Finding{{Kind: FindingWrongAnswer, Domain: "www.example.com", Detail: "returned unexpected 198.51.100.7"}}
+	if len(results[1].Findings) != 1 || results[1].Findings[0] != want[0] {
+		t.Errorf("bad: findings = %v, want %v", results[1].Findings, want)
+	}
+}
@@ -0,0 +1,86 @@
+package dnsbench
+
+import "time"
+
+// Delta compares one provider's results in two runs. The differences are
+// After minus Before, so a negative latency delta means After was faster.
+// They are only meaningful when the provider answered in both runs.
+type Delta struct {
+	Provider string
+	// Before and After are the provider's results in each run, and
+	// InBefore and InAfter report whether it took part at all.
+	Before, After     TestResult
+	InBefore, InAfter bool
+	Median            time.Duration
+	P95               time.Duration
+	// Loss is the change in percentage points.
+	Loss float64
+}
+
+// Comparable reports whether the provider answered in both runs.
+func (d Delta) Comparable() bool {
+	return d.InBefore && d.InAfter && d.Before.Success && d.After.Success
+}
+
+// Compare pairs up the providers of two runs by name: those of after in
+// its order, then those only found in before.
+func Compare(before, after Report) []Delta {
+	var deltas []Delta
+	index := make(map[string]int)
+	for _, r := range after.Results {
+		index[r.Provider.Name] = len(deltas)
+		deltas = append(deltas, Delta{Provider: r.Provider.Name, After: r, InAfter: true})
+	}
+	for _, r := range before.Results {
+		i, ok := index[r.Provider.Name]
+		if !ok {
+			i = len(deltas)
+			deltas = append(deltas, Delta{Provider: r.Provider.Name})
+		}
+		deltas[i].Before = r
+		deltas[i].InBefore = true
+	}
+	for i := range deltas {
+		d := &deltas[i]
+		if d.Comparable() {
+			d.Median = d.After.Median - d.Before.Median
+			d.P95 = d.After.P95 - d.Before.P95
+			d.Loss = d.After.Loss - d.Before.Loss
+		}
+	}
+	return deltas
+}
+
+// TrendPoint is how a provider did in one run.
+type TrendPoint struct {
+	StartedAt time.Time
+	Success   bool
+	Median    time.Duration
+	Loss      float64
+	// Instance identifies the server that answered, if the run asked.
+	Instance string
+}
+
+// Trend follows a provider across reports, in their order, skipping runs it
+// was not part of.
+func Trend(reports []Report, provider string) []TrendPoint {
+	var points []TrendPoint
+	for _, report := range reports {
+		for _, r := range report.Results {
+			if r.Provider.Name == provider {
+				point := TrendPoint{
+					StartedAt: report.StartedAt,
+					Success:   r.Success,
+					Median:    r.Median,
+					Loss:      r.Loss,
+				}
+				if r.Identity != nil {
+					point.Instance = r.Identity.Instance()
+				}
+				points = append(points, point)
+				break
+			}
+		}
+	}
+	return points
+}
@@ -0,0 +1,63 @@
+package dnsbench
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func stubResult(name string, success bool, median time.Duration, loss float64) TestResult {
+	return TestResult{
+		Provider: DNSProvider{Name: name},
+		Success:  success,
+		Stats:    Stats{Median: median, P95: 2 * median, Loss: loss},
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before := Report{Results: []TestResult{
+		stubResult("a", true, 20*time.Millisecond, 0),
+		stubResult("gone", true, 5*time.Millisecond, 0),
+		stubResult("b", false, 0, 100),
+	}}
+	after := Report{Results: []TestResult{
+		stubResult("b", true, 30*time.Millisecond, 10),
+		stubResult("a", true, 15*time.Millisecond, 20),
+		stubResult("new", true, 10*time.Millisecond, 0),
+	}}
+
+	deltas := Compare(before, after)
+	var names []string
+	for _, d := range deltas {
+		names = append(names, d.Provider)
+	}
+	if want := []string{"b", "a", "new", "gone"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("providers %q, want %q", names, want)
+	}
+	if a := deltas[1]; !a.Comparable() || a.Median != -5*time.Millisecond || a.P95 != -10*time.Millisecond || a.Loss != 20 {
+		t.Errorf("a: %+v", a)
+	}
+	if b := deltas[0]; b.Comparable() || b.Median != 0 {
+		t.Errorf("b failed before but was compared: %+v", b)
+	}
+	if n, g := deltas[2], deltas[3]; n.InBefore || !n.InAfter || !g.InBefore || g.InAfter {
+		t.Errorf("new %+v, gone %+v", n, g)
+	}
+}
+
+func TestTrend(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	reports := []Report{
+		{StartedAt: day(1), Results: []TestResult{stubResult("a", true, 20*time.Millisecond, 0)}},
+		{StartedAt: day(2), Results: []TestResult{stubResult("b", true, 10*time.Millisecond, 0)}},
+		{StartedAt: day(3), Results: []TestResult{stubResult("b", true, 9*time.Millisecond, 0), stubResult("a", false, 0, 100)}},
+	}
+	reports[0].Results[0].Identity = &ResolverIdentity{IDServer: "AMS"}
+	want := []TrendPoint{
+		{StartedAt: day(1), Success: true, Median: 20 * time.Millisecond, Instance: "AMS"},
+		{StartedAt: day(3), Loss: 100},
+	}
+	if got := Trend(reports, "a"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Trend = %+v, want %+v", got, want)
+	}
+}
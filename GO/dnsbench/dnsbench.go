@@ -0,0 +1,341 @@
+// Package dnsbench measures the latency of DNS resolvers.
+//
+// It is the engine behind both the command-line tool and the GUI, and can be
+// used directly from other Go programs:
+//
+//	results := dnsbench.Run(ctx, dnsbench.DefaultProviders, dnsbench.DefaultConfig(), nil)
+//	dnsbench.SortByLatency(results)
+package dnsbench
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNSProvider is a resolver under test.
+type DNSProvider struct {
+	Name string
+	IP   string
+	IPv6 string
+	// URL is the RFC 8484 endpoint of a DNS-over-HTTPS provider. When set,
+	// queries are sent there instead of to IP port 53.
+	URL string
+	// Port overrides the transport's default port (53, or 853 for
+	// DNS-over-TLS and DNS-over-QUIC).
+	Port int
+	// ServerName is the name the TLS certificate is checked against for
+	// DNS-over-TLS and DNS-over-QUIC. It defaults to the IP address being
+	// dialed.
+	ServerName string
+	// Transport pins the provider to one protocol regardless of
+	// TestConfig. Empty uses the TestConfig's choice.
+	Transport Transport
+}
+
+// Address is the endpoint shown to users: the DoH URL if there is one,
+// otherwise the IPv4 address, or the IPv6 address for IPv6-only providers.
+func (p DNSProvider) Address() string {
+	if p.URL != "" {
+		return p.URL
+	}
+	if p.IP == "" {
+		return p.IPv6
+	}
+	return p.IP
+}
+
+// Validate reports what is wrong with a provider that cannot be tested.
+func (p DNSProvider) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("provider has no name")
+	}
+	switch p.Transport {
+	case "", TransportUDP, TransportTCP, TransportDoH, TransportDoT, TransportDoQ:
+	default:
+		return fmt.Errorf("%s: unknown transport %q", p.Name, p.Transport)
+	}
+	if p.URL != "" || p.Transport == TransportDoH {
+		if u, err := url.Parse(p.URL); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("%s: DNS-over-HTTPS needs an https:// URL", p.Name)
+		}
+		return nil
+	}
+	if p.IP == "" && p.IPv6 == "" {
+		return fmt.Errorf("%s: needs an IPv4 or IPv6 address", p.Name)
+	}
+	if a, err := netip.ParseAddr(p.IP); p.IP != "" && (err != nil || !a.Is4()) {
+		return fmt.Errorf("%s: %q is not an IPv4 address", p.Name, p.IP)
+	}
+	if a, err := netip.ParseAddr(p.IPv6); p.IPv6 != "" && (err != nil || !a.Is6() || a.Is4In6()) {
+		return fmt.Errorf("%s: %q is not an IPv6 address", p.Name, p.IPv6)
+	}
+	if p.Port < 0 || p.Port > 65535 {
+		return fmt.Errorf("%s: port %d is out of range", p.Name, p.Port)
+	}
+	return nil
+}
+
+// Transport is the protocol a query was sent over.
+type Transport string
+
+const (
+	TransportUDP Transport = "udp"
+	TransportTCP Transport = "tcp"
+	TransportDoH Transport = "doh"
+	TransportDoT Transport = "dot"
+	TransportDoQ Transport = "doq"
+)
+
+// TestConfig controls how a benchmark is run.
+type TestConfig struct {
+	TestsPerDomain int
+	Timeout        time.Duration
+	UseTCP         bool
+	UseTLS         bool
+	UseQUIC        bool
+	UseIPv6        bool
+	ParallelTests  bool
+	// Concurrency caps the queries in flight to each provider when
+	// ParallelTests is set. Zero means no limit.
+	Concurrency int
+	// QueryType is the record type queries ask for, "A" by default.
+	QueryType string
+	// DomainTypes lists, per domain, the record types to ask for instead of
+	// QueryType. Each type gets TestsPerDomain queries.
+	DomainTypes map[string][]string
+	// UncachedTests adds a query for a unique random name next to every
+	// regular one, measuring full recursive resolution instead of cache hits.
+	// The names are placed under UncachedZone, or under each test domain
+	// when it is empty.
+	UncachedTests bool
+	UncachedZone  string
+	// CheckAnswers compares every provider's answers with the others' and
+	// probes for NXDOMAIN redirection, reporting problems as Findings.
+	CheckAnswers bool
+	// ExpectedAnswers lists, per domain, the IP addresses or CIDR prefixes
+	// that are acceptable answers. Domains listed here are checked against
+	// it instead of against the other providers.
+	ExpectedAnswers map[string][]string
+	// CheckDNSSEC probes whether each provider validates DNSSEC by looking
+	// up DNSSECSigned, a name in a signed zone, and DNSSECBroken, a name
+	// whose signatures do not validate. Empty names mean
+	// DefaultDNSSECSigned and DefaultDNSSECBroken.
+	CheckDNSSEC                bool
+	DNSSECSigned, DNSSECBroken string
+	// ClientSubnet, if set, is sent with every query as an EDNS Client
+	// Subnet option (RFC 7871), such as "198.51.100.0/24". A bare address
+	// stands for its /24 or /56.
+	ClientSubnet string
+	// IdentifyResolver asks each provider which of its servers answered,
+	// with the NSID option and CHAOS-class id.server and hostname.bind
+	// queries.
+	IdentifyResolver bool
+	// DoHMethod is "GET" (the default) or "POST".
+	DoHMethod string
+	// DoQReconnect opens a new DNS-over-QUIC connection for every query
+	// instead of sharing one, so that 0-RTT session resumption is measured.
+	DoQReconnect bool
+	// Domains to query; DefaultDomains is used when empty.
+	Domains []string
+	// TLSConfig is the base configuration for encrypted transports. Nil
+	// verifies servers against the system roots.
+	TLSConfig *tls.Config `json:"-"`
+}
+
+// QueryResult is the outcome of a single query against a provider.
+type QueryResult struct {
+	Provider  string
+	Domain    string
+	QueryType string
+	Transport Transport
+	// Uncached marks a query for a random name that cannot be cached.
+	Uncached  bool
+	TimeStamp time.Time
+	Latency   time.Duration
+	Success   bool
+	Error     string
+
+	// What the server sent back: the response code, header flags in dig
+	// notation (e.g. "qr rd ra ad"), the number of answer records and their
+	// TTLs, and the size of the response in bytes.
+	Rcode   string
+	Flags   string
+	Answers int
+	TTLs    []uint32
+	Size    int
+	// Addrs are the A and AAAA addresses in the answer.
+	Addrs []string
+	// CNAMEs are the aliases the answer followed, in order.
+	CNAMEs []string
+	// ECSEchoed is set when the response carried an EDNS Client Subnet
+	// option, and ECSScope is its scope prefix length: how much of the
+	// subnet the answer is specific to, zero meaning any client.
+	ECSEchoed bool
+	ECSScope  int
+
+	// Handshake is the part of Latency spent setting up a new encrypted
+	// connection. It is zero when Reused is set.
+	Handshake time.Duration
+	Reused    bool
+	// ZeroRTT is set when a new DNS-over-QUIC connection carried the query
+	// as 0-RTT early data.
+	ZeroRTT bool
+	// Breakdown of the rest of Latency for DNS-over-HTTPS.
+	RoundTrip time.Duration
+	Answer    time.Duration
+}
+
+// TestResult summarises all queries sent to one provider.
+type TestResult struct {
+	Provider DNSProvider
+	// Latency is the mean over successful queries, or the timeout if none
+	// succeeded. It and Stats cover the regular, cacheable queries only.
+	Latency    time.Duration
+	Success    bool
+	TestsDone  int
+	TotalTests int
+	// Cancelled is set when the run was stopped before every query had
+	// finished. The figures then cover the queries that did.
+	Cancelled bool
+	Errors    []string
+	TimeStamp time.Time
+	Stats
+	// TypeStats breaks Stats down by record type when more than one type
+	// was queried.
+	TypeStats map[string]Stats
+	// The same figures for UncachedTests queries.
+	UncachedLatency time.Duration
+	UncachedStats   Stats
+	// Findings are signs of hijacked or rewritten answers.
+	Findings []Finding
+	// DNSSEC is what CheckDNSSEC found out, or nil if it did not run.
+	DNSSEC *DNSSECSupport
+	// ECS sums up the responses to ClientSubnet, or is nil if none was
+	// sent.
+	ECS *ECSSupport
+	// Identity is what IdentifyResolver found out, or nil if it did not
+	// run.
+	Identity *ResolverIdentity
+	// For connection-oriented encrypted transports, the mean latency of
+	// queries that opened a new connection and of queries that reused one,
+	// and the mean time spent establishing those new connections.
+	FirstQueryLatency time.Duration
+	ReusedLatency     time.Duration
+	HandshakeLatency  time.Duration
+	// For DNS-over-QUIC, the mean latency of queries on new connections that
+	// were resumed with 0-RTT and of those that needed a full handshake.
+	ZeroRTTLatency time.Duration
+	OneRTTLatency  time.Duration
+	Queries        []QueryResult
+}
+
+var (
+	DefaultProviders = []DNSProvider{
+		{Name: "Cloudflare", IP: "1.1.1.1", IPv6: "2606:4700:4700::1111", ServerName: "cloudflare-dns.com"},
+		{Name: "Cloudflare Secondary", IP: "1.0.0.1", IPv6: "2606:4700:4700::1001", ServerName: "cloudflare-dns.com"},
+		{Name: "Google", IP: "8.8.8.8", IPv6: "2001:4860:4860::8888", ServerName: "dns.google"},
+		{Name: "Google Secondary", IP: "8.8.4.4", IPv6: "2001:4860:4860::8844", ServerName: "dns.google"},
+		{Name: "Quad9", IP: "9.9.9.9", IPv6: "2620:fe::fe", ServerName: "dns.quad9.net"},
+		{Name: "Quad9 Secondary", IP: "149.112.112.112", IPv6: "2620:fe::9", ServerName: "dns.quad9.net"},
+		{Name: "OpenDNS", IP: "208.67.222.222", IPv6: "2620:119:35::35"},
+		{Name: "OpenDNS Secondary", IP: "208.67.220.220", IPv6: "2620:119:53::53"},
+		{Name: "Comodo", IP: "8.26.56.26"},
+		{Name: "Comodo Secondary", IP: "8.20.247.20"},
+		{Name: "AdGuard", IP: "94.140.14.14", IPv6: "2a10:50c0::ad1:ff", ServerName: "dns.adguard-dns.com"},
+		{Name: "CleanBrowsing", IP: "185.228.168.9", IPv6: "2a0d:2a00:1::2", ServerName: "security-filter-dns.cleanbrowsing.org"},
+		{Name: "Alternate DNS", IP: "76.76.19.19", IPv6: "2602:fcbc::ad"},
+		{Name: "Cloudflare DoH", URL: "https://cloudflare-dns.com/dns-query"},
+		{Name: "Google DoH", URL: "https://dns.google/dns-query"},
+		{Name: "Quad9 DoH", URL: "https://dns.quad9.net/dns-query"},
+	}
+	DefaultDomains = []string{
+		"www.google.com",
+		"www.amazon.com",
+		"www.netflix.com",
+		"www.facebook.com",
+		"www.microsoft.com",
+		"www.apple.com",
+		"www.github.com",
+	}
+)
+
+// DefaultConfig returns the settings the GUI starts with.
+func DefaultConfig() TestConfig {
+	return TestConfig{
+		TestsPerDomain: 3,
+		Timeout:        3 * time.Second,
+		UseTCP:         false,
+		UseIPv6:        false,
+		ParallelTests:  true,
+	}
+}
+
+func (c TestConfig) transport(p DNSProvider) Transport {
+	switch {
+	case p.URL != "":
+		return TransportDoH
+	case p.Transport != "":
+		return p.Transport
+	case c.UseQUIC:
+		return TransportDoQ
+	case c.UseTLS:
+		return TransportDoT
+	case c.UseTCP:
+		return TransportTCP
+	default:
+		return TransportUDP
+	}
+}
+
+// serverAddr is the host:port queries to p are sent to.
+func (c TestConfig) serverAddr(p DNSProvider, transport Transport) string {
+	ip := p.IP
+	if (c.UseIPv6 || ip == "") && p.IPv6 != "" {
+		ip = p.IPv6
+	}
+	port := p.Port
+	if port == 0 {
+		port = 53
+		if transport == TransportDoT || transport == TransportDoQ {
+			port = 853
+		}
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// Types returns the record types domain is queried with.
+func (c TestConfig) Types(domain string) []string {
+	if types := c.DomainTypes[domain]; len(types) > 0 {
+		return types
+	}
+	if c.QueryType == "" {
+		return []string{"A"}
+	}
+	return []string{c.QueryType}
+}
+
+func (c TestConfig) domains() []string {
+	if len(c.Domains) == 0 {
+		return DefaultDomains
+	}
+	return c.Domains
+}
+
+// TotalTests is the number of queries a run sends to each provider.
+func (c TestConfig) TotalTests() int {
+	n := 0
+	for _, domain := range c.domains() {
+		n += len(c.Types(domain)) * c.TestsPerDomain
+	}
+	if c.UncachedTests {
+		n *= 2
+	}
+	return n
+}
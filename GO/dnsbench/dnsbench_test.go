@@ -0,0 +1,48 @@
+package dnsbench
+
+import (
+	"context"
+	"testing"
+
+	"dns_speed_test/dnsbench/dnstest"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		provider DNSProvider
+		ok       bool
+	}{
+		{DNSProvider{Name: "v4", IP: "192.0.2.1"}, true},
+		{DNSProvider{Name: "v6 only", IPv6: "2001:db8::1", Port: 5353, Transport: TransportTCP}, true},
+		{DNSProvider{Name: "doh", URL: "https://dns.example/dns-query"}, true},
+		{DNSProvider{IP: "192.0.2.1"}, false},
+		{DNSProvider{Name: "no address"}, false},
+		{DNSProvider{Name: "swapped", IP: "2001:db8::1"}, false},
+		{DNSProvider{Name: "mapped", IPv6: "::ffff:192.0.2.1"}, false},
+		{DNSProvider{Name: "hostname", IP: "dns.example"}, false},
+		{DNSProvider{Name: "port", IP: "192.0.2.1", Port: 70000}, false},
+		{DNSProvider{Name: "transport", IP: "192.0.2.1", Transport: "smtp"}, false},
+		{DNSProvider{Name: "doh without url", IP: "192.0.2.1", Transport: TransportDoH}, false},
+		{DNSProvider{Name: "plain http", URL: "http://dns.example/dns-query"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.provider.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v: Validate() = %v, want ok=%v", tt.provider, err, tt.ok)
+		}
+	}
+}
+
+func TestProviderTransportOverridesConfig(t *testing.T) {
+	provider, config, _ := newPlainServer(t, dnstest.Faults{})
+	provider.Transport = TransportTCP
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if !result.Success {
+		t.Fatalf("run failed: %v", result.Errors)
+	}
+	for _, q := range result.Queries {
+		if q.Transport != TransportTCP {
+			t.Errorf("query sent over %s, want tcp", q.Transport)
+		}
+	}
+}
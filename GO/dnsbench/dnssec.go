@@ -0,0 +1,93 @@
+package dnsbench
+
+import (
+	"context"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// The names CheckDNSSEC looks up unless the TestConfig names others:
+// a zone signed since 2009, and one whose signatures are kept broken for
+// testing validators.
+const (
+	DefaultDNSSECSigned = "isc.org"
+	DefaultDNSSECBroken = "dnssec-failed.org"
+)
+
+// DNSSECSupport describes how a provider handles DNSSEC.
+type DNSSECSupport struct {
+	// AuthenticData is set when the answer for the signed name had the AD
+	// bit, meaning the provider validated it.
+	AuthenticData bool
+	// RejectsBogus is set when the name with broken signatures got
+	// SERVFAIL instead of an answer.
+	RejectsBogus bool
+	// RRSIG is set when the answer for the signed name carried its RRSIG
+	// records, as asked for with the DO bit.
+	RRSIG bool
+	// Error explains why the signed name could not be looked up, in which
+	// case nothing is known.
+	Error string
+}
+
+// Validates reports whether the provider validates DNSSEC: it vouches for
+// signed answers and refuses ones that fail validation.
+func (d DNSSECSupport) Validates() bool {
+	return d.AuthenticData && d.RejectsBogus
+}
+
+// String sums d up in a few words, such as "validating" or "not
+// validating, no RRSIG".
+func (d DNSSECSupport) String() string {
+	var s string
+	switch {
+	case d.Error != "":
+		return "unknown: " + d.Error
+	case d.Validates():
+		s = "validating"
+	case d.AuthenticData:
+		s = "sets AD but answers bogus names"
+	case d.RejectsBogus:
+		s = "rejects bogus names but sets no AD"
+	default:
+		s = "not validating"
+	}
+	if !d.RRSIG {
+		s += ", no RRSIG"
+	}
+	return s
+}
+
+// probeDNSSEC looks up the signed and the broken name with the DO bit set.
+func probeDNSSEC(ctx context.Context, c exchanger, provider DNSProvider, config TestConfig, transport Transport) *DNSSECSupport {
+	signed, broken := config.DNSSECSigned, config.DNSSECBroken
+	if signed == "" {
+		signed = DefaultDNSSECSigned
+	}
+	if broken == "" {
+		broken = DefaultDNSSECBroken
+	}
+	opts := queryOptions{dnssecOK: true}
+	lookup := func(name string) (*dnsmessage.Message, error) {
+		qctx, cancel := context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+		q := QueryResult{Provider: provider.Name, Domain: name, Transport: transport}
+		return lookupWith(qctx, c, name, dnsmessage.TypeA, opts, &q)
+	}
+
+	var d DNSSECSupport
+	reply, err := lookup(signed)
+	if err != nil {
+		d.Error = err.Error()
+		return &d
+	}
+	d.AuthenticData = reply.AuthenticData
+	for _, rr := range reply.Answers {
+		if rr.Header.Type == typeRRSIG {
+			d.RRSIG = true
+		}
+	}
+	reply, _ = lookup(broken)
+	d.RejectsBogus = reply != nil && reply.RCode == dnsmessage.RCodeServerFailure
+	return &d
+}
@@ -0,0 +1,62 @@
+package dnsbench
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench/dnstest"
+)
+
+func TestCheckDNSSEC(t *testing.T) {
+	tests := []struct {
+		name    string
+		faults  dnstest.Faults
+		want    DNSSECSupport
+		summary string
+	}{
+		{"validating", dnstest.Faults{}, DNSSECSupport{AuthenticData: true, RejectsBogus: true, RRSIG: true}, "validating"},
+		{"not validating", dnstest.Faults{NoValidation: true}, DNSSECSupport{RRSIG: true}, "not validating"},
+		{"stripping RRSIG", dnstest.Faults{StripRRSIG: true}, DNSSECSupport{AuthenticData: true, RejectsBogus: true}, "validating, no RRSIG"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, _ := newMockServer(t, tt.name, "example.com", tt.faults)
+			config := TestConfig{
+				Domains:        []string{"www.example.com"},
+				TestsPerDomain: 1,
+				Timeout:        time.Second,
+				CheckDNSSEC:    true,
+				DNSSECSigned:   dnstest.SignedLabel + ".example.com",
+				DNSSECBroken:   dnstest.BogusLabel + ".example.com",
+			}
+			r := TestProvider(context.Background(), provider, config, nil)
+			if r.DNSSEC == nil {
+				t.Fatal("DNSSEC not checked")
+			}
+			if *r.DNSSEC != tt.want || r.DNSSEC.String() != tt.summary {
+				t.Errorf("DNSSEC = %+v (%q), want %+v (%q)", *r.DNSSEC, r.DNSSEC, tt.want, tt.summary)
+			}
+		})
+	}
+}
+
+func TestCheckDNSSECUnanswered(t *testing.T) {
+	provider, _ := newMockServer(t, "broken", "example.com", dnstest.Faults{ServFailRate: 1})
+	config := TestConfig{
+		Domains:        []string{"www.example.com"},
+		TestsPerDomain: 1,
+		Timeout:        time.Second,
+		CheckDNSSEC:    true,
+		DNSSECSigned:   dnstest.SignedLabel + ".example.com",
+		DNSSECBroken:   dnstest.BogusLabel + ".example.com",
+	}
+	r := TestProvider(context.Background(), provider, config, nil)
+	if r.DNSSEC == nil || r.DNSSEC.Error == "" || r.DNSSEC.Validates() {
+		t.Errorf("DNSSEC = %+v for a provider that fails every query", r.DNSSEC)
+	}
+	config.CheckDNSSEC = false
+	if r := TestProvider(context.Background(), provider, config, nil); r.DNSSEC != nil {
+		t.Errorf("DNSSEC checked without CheckDNSSEC: %+v", r.DNSSEC)
+	}
+}
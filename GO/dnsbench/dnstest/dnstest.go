@@ -0,0 +1,558 @@
+// Package dnstest provides an in-process DNS server for tests. It answers
+// A and AAAA queries with fixed documentation addresses, and MX, TXT, NS,
+// SOA, SRV, HTTPS and SVCB queries with fixed records, and can be told to
+// misbehave the way real resolvers do: answer slowly, lose queries, fail,
+// truncate, or lie.
+//
+// A name whose first label is AliasLabel is an alias for the rest of the
+// name, so "alias.alias.example.com" is answered with a chain of two CNAME
+// records followed by the answer for "example.com".
+//
+// Names whose first label is SignedLabel stand in for a DNSSEC-signed zone
+// and those whose first label is BogusLabel for a zone whose signatures
+// fail validation. The server acts as a validating resolver: it sets the
+// AD bit on signed answers, returns SERVFAIL for bogus names and adds
+// RRSIG records when the query has the DO bit. The signatures are filler
+// and do not verify.
+//
+// An EDNS Client Subnet option in a query is echoed in the response with
+// its source prefix length as the scope, as by a resolver that passed the
+// subnet on to an authoritative server which tailored the answer to it.
+//
+// A server given an identity with SetIdentity returns it for the NSID
+// option and the CHAOS-class id.server and hostname.bind queries; others
+// refuse CHAOS queries and ignore NSID, as many resolvers do.
+//
+// SetAddrs changes the addresses a server answers with, as when resolvers
+// are handed different CDN edges, and SetCaching makes it a caching
+// resolver that is slow to answer names it has not been asked for before.
+package dnstest
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// The addresses the server answers with, and those it gives out instead
+// for WrongAnswerRate.
+var (
+	AddrA     = netip.MustParseAddr("192.0.2.1")
+	AddrAAAA  = netip.MustParseAddr("2001:db8::1")
+	WrongA    = netip.MustParseAddr("203.0.113.66")
+	WrongAAAA = netip.MustParseAddr("2001:db8:bad::66")
+)
+
+// TTL is the TTL of every answer record.
+const TTL = 60
+
+// AliasLabel starts the names answered with a CNAME.
+const AliasLabel = "alias"
+
+// The content of the TXT records.
+const TXT = "v=spf1 -all"
+
+// The first labels of names in the signed and the broken zone.
+const (
+	SignedLabel = "signed"
+	BogusLabel  = "bogus"
+)
+
+const typeRRSIG dnsmessage.Type = 46
+
+// EDNS option codes.
+const (
+	optionNSID = 3
+	optionECS  = 8
+)
+
+// maxUDPSize is the largest response sent without EDNS.
+const maxUDPSize = 512
+
+// Faults describes how a server misbehaves. Rates are the fraction of
+// queries affected, from 0 (never) to 1 (always), and are drawn
+// independently in the order of the fields; the first one that hits
+// decides the response. The draws come from a source seeded with Seed, so
+// a sequence of queries always meets the same faults.
+type Faults struct {
+	// Every response is held back for Delay plus a random part of Jitter.
+	Delay  time.Duration
+	Jitter time.Duration
+	// DropRate queries get no response at all.
+	DropRate float64
+	// These get an empty response with the corresponding rcode.
+	ServFailRate float64
+	RefusedRate  float64
+	NXDomainRate float64
+	// TruncateRate responses over UDP have the TC bit set and no answers,
+	// as if the answer did not fit. TCP responses are never truncated.
+	TruncateRate float64
+	// WrongAnswerRate responses carry WrongA or WrongAAAA instead of the
+	// real address.
+	WrongAnswerRate float64
+	// MismatchRate responses answer a different question than was asked.
+	MismatchRate float64
+	Seed         int64
+	// ServFailTypes are record types always answered with SERVFAIL, like
+	// resolvers that cannot handle newer types.
+	ServFailTypes []dnsmessage.Type
+	// NoValidation makes the server a resolver that does not validate
+	// DNSSEC: it never sets the AD bit and answers bogus names.
+	NoValidation bool
+	// StripRRSIG leaves RRSIG records out even when the DO bit asks for
+	// them.
+	StripRRSIG bool
+	// IgnoreECS drops the EDNS Client Subnet option from responses, and
+	// ECSUnscoped returns it with scope 0, as a resolver that does not
+	// pass the subnet upstream.
+	IgnoreECS   bool
+	ECSUnscoped bool
+}
+
+// Server is a DNS server listening on a UDP and a TCP socket with the
+// same loopback port.
+type Server struct {
+	zone    string
+	pc      net.PacketConn
+	ln      net.Listener
+	queries atomic.Int64
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	faults   Faults
+	rand     *rand.Rand
+	identity string
+	a, aaaa  netip.Addr
+	// With resolveDelay set, cached holds the names asked for so far.
+	resolveDelay   time.Duration
+	cached         map[string]bool
+	inFlight, peak int
+}
+
+// NewServer starts a server. If zone is not empty, only names under it are
+// answered and everything else is NXDOMAIN, like a resolver asked about a
+// name that does not exist.
+func NewServer(zone string, faults Faults) (*Server, error) {
+	s := &Server{zone: strings.ToLower(strings.Trim(zone, ".")), a: AddrA, aaaa: AddrAAAA}
+	s.SetFaults(faults)
+	for {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		ln, err := net.Listen("tcp", pc.LocalAddr().String())
+		if err != nil {
+			// The port is taken for TCP; try another one.
+			pc.Close()
+			continue
+		}
+		s.pc, s.ln = pc, ln
+		break
+	}
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return s, nil
+}
+
+// SetFaults replaces the server's faults and restarts their random source.
+func (s *Server) SetFaults(faults Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = faults
+	s.rand = rand.New(rand.NewSource(faults.Seed))
+}
+
+// SetIdentity sets the instance name the server gives when asked, as one
+// site of an anycast service would.
+func (s *Server) SetIdentity(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identity = id
+}
+
+// SetAddrs sets the addresses A and AAAA queries are answered with in
+// place of AddrA and AddrAAAA. WrongAnswerRate still gives out WrongA and
+// WrongAAAA.
+func (s *Server) SetAddrs(a, aaaa netip.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.a, s.aaaa = a, aaaa
+}
+
+// SetCaching makes the server a caching resolver: the first query for a
+// name takes resolveDelay longer to answer, as if it were being resolved,
+// and later ones are answered from the cache. The names given are cached
+// already.
+func (s *Server) SetCaching(resolveDelay time.Duration, names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolveDelay = resolveDelay
+	s.cached = make(map[string]bool)
+	for _, name := range names {
+		s.cached[strings.ToLower(strings.TrimSuffix(name, "."))] = true
+	}
+}
+
+// PeakInFlight is the largest number of queries the server has been
+// answering at the same time.
+func (s *Server) PeakInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peak
+}
+
+// Addr is the address of both sockets.
+func (s *Server) Addr() netip.AddrPort {
+	return netip.MustParseAddrPort(s.pc.LocalAddr().String())
+}
+
+// Queries is the number of queries received so far, including dropped ones.
+func (s *Server) Queries() int {
+	return int(s.queries.Load())
+}
+
+// Close stops the server and waits for its listeners to exit. Responses
+// still being delayed are discarded.
+func (s *Server) Close() {
+	s.pc.Close()
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			if resp := s.respond(query, true); resp != nil {
+				s.pc.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				resp := s.respond(query, false)
+				if resp == nil {
+					continue
+				}
+				b := binary.BigEndian.AppendUint16(nil, uint16(len(resp)))
+				if _, err := conn.Write(append(b, resp...)); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// fault is the outcome of the dice for one query.
+type fault int
+
+const (
+	none fault = iota
+	drop
+	servFail
+	refused
+	nxDomain
+	truncate
+	wrongAnswer
+	mismatch
+)
+
+// roll decides which fault, if any, hits the next query and how long its
+// response is delayed.
+func (s *Server) roll() (fault, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.faults
+	delay := f.Delay
+	if f.Jitter > 0 {
+		delay += time.Duration(s.rand.Int63n(int64(f.Jitter)))
+	}
+	for _, c := range []struct {
+		rate  float64
+		fault fault
+	}{
+		{f.DropRate, drop},
+		{f.ServFailRate, servFail},
+		{f.RefusedRate, refused},
+		{f.NXDomainRate, nxDomain},
+		{f.TruncateRate, truncate},
+		{f.WrongAnswerRate, wrongAnswer},
+		{f.MismatchRate, mismatch},
+	} {
+		if c.rate > 0 && s.rand.Float64() < c.rate {
+			return c.fault, delay
+		}
+	}
+	return none, delay
+}
+
+func (s *Server) servFailType(t dnsmessage.Type) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, failing := range s.faults.ServFailTypes {
+		if failing == t {
+			return true
+		}
+	}
+	return false
+}
+
+// answers returns the answer records for a question, following aliases.
+// A and AAAA queries are answered with a and aaaa.
+func answers(name dnsmessage.Name, t dnsmessage.Type, a, aaaa netip.Addr) []dnsmessage.Resource {
+	hdr := dnsmessage.ResourceHeader{Name: name, Type: t, Class: dnsmessage.ClassINET, TTL: TTL}
+	if label, rest, ok := strings.Cut(name.String(), "."); ok && strings.EqualFold(label, AliasLabel) && strings.Count(rest, ".") > 1 {
+		target := mustName(rest)
+		hdr.Type = dnsmessage.TypeCNAME
+		cname := dnsmessage.Resource{Header: hdr, Body: &dnsmessage.CNAMEResource{CNAME: target}}
+		if t == dnsmessage.TypeCNAME {
+			return []dnsmessage.Resource{cname}
+		}
+		return append([]dnsmessage.Resource{cname}, answers(target, t, a, aaaa)...)
+	}
+
+	var body dnsmessage.ResourceBody
+	switch t {
+	case dnsmessage.TypeA:
+		body = &dnsmessage.AResource{A: a.As4()}
+	case dnsmessage.TypeAAAA:
+		body = &dnsmessage.AAAAResource{AAAA: aaaa.As16()}
+	case dnsmessage.TypeMX:
+		body = &dnsmessage.MXResource{Pref: 10, MX: mustName("mail." + name.String())}
+	case dnsmessage.TypeTXT:
+		body = &dnsmessage.TXTResource{TXT: []string{TXT}}
+	case dnsmessage.TypeNS:
+		body = &dnsmessage.NSResource{NS: mustName("ns1." + name.String())}
+	case dnsmessage.TypeSOA:
+		body = &dnsmessage.SOAResource{
+			NS: mustName("ns1." + name.String()), MBox: mustName("hostmaster." + name.String()),
+			Serial: 1, Refresh: 3600, Retry: 600, Expire: 86400, MinTTL: TTL,
+		}
+	case dnsmessage.TypeSRV:
+		body = &dnsmessage.SRVResource{Priority: 10, Weight: 5, Port: 5060, Target: mustName("sip." + name.String())}
+	case 64, 65: // SVCB and HTTPS
+		// Priority 1, the owner name as target, and "alpn=h2".
+		data := []byte{0, 1, 0, 0, 1, 0, 3, 2, 'h', '2'}
+		body = &dnsmessage.UnknownResource{Type: t, Data: data}
+	default:
+		return nil
+	}
+	return []dnsmessage.Resource{{Header: hdr, Body: body}}
+}
+
+// answerOptions turns the EDNS options of a query into those of the
+// response: the EDNS Client Subnet option is echoed with a scope or
+// removed, and the NSID option is answered with identity or removed.
+func answerOptions(msg *dnsmessage.Message, ignoreECS, ecsUnscoped bool, identity string) {
+	for _, rr := range msg.Additionals {
+		opt, ok := rr.Body.(*dnsmessage.OPTResource)
+		if !ok {
+			continue
+		}
+		var options []dnsmessage.Option
+		for _, o := range opt.Options {
+			switch o.Code {
+			case optionECS:
+				if ignoreECS || len(o.Data) < 4 {
+					continue
+				}
+				o.Data = append([]byte(nil), o.Data...)
+				o.Data[3] = o.Data[2]
+				if ecsUnscoped {
+					o.Data[3] = 0
+				}
+			case optionNSID:
+				if identity == "" {
+					continue
+				}
+				o.Data = []byte(identity)
+			}
+			options = append(options, o)
+		}
+		opt.Options = options
+	}
+}
+
+// dnssecOK reports whether msg has an OPT record with the DO bit.
+func dnssecOK(msg dnsmessage.Message) bool {
+	for _, rr := range msg.Additionals {
+		if rr.Header.Type == dnsmessage.TypeOPT && rr.Header.DNSSECAllowed() {
+			return true
+		}
+	}
+	return false
+}
+
+// signed follows every record with an RRSIG record covering it.
+func signed(records []dnsmessage.Resource) []dnsmessage.Resource {
+	var out []dnsmessage.Resource
+	for _, rr := range records {
+		owner := rr.Header.Name.String()
+		data := binary.BigEndian.AppendUint16(nil, uint16(rr.Header.Type))
+		// Algorithm 13 (ECDSA P-256 with SHA-256) and the label count.
+		data = append(data, 13, byte(strings.Count(owner, ".")))
+		data = binary.BigEndian.AppendUint32(data, rr.Header.TTL)
+		now := uint32(time.Now().Unix())
+		data = binary.BigEndian.AppendUint32(data, now+86400) // expiration
+		data = binary.BigEndian.AppendUint32(data, now-3600)  // inception
+		data = binary.BigEndian.AppendUint16(data, 12345)     // key tag
+		for _, l := range strings.Split(strings.TrimSuffix(owner, "."), ".") {
+			data = append(append(data, byte(len(l))), l...)
+		}
+		data = append(data, 0)
+		data = append(data, make([]byte, 64)...) // signature
+		hdr := rr.Header
+		hdr.Type = typeRRSIG
+		out = append(out, rr, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.UnknownResource{Type: typeRRSIG, Data: data}})
+	}
+	return out
+}
+
+func mustName(s string) dnsmessage.Name {
+	if !strings.HasSuffix(s, ".") {
+		s += "."
+	}
+	return dnsmessage.MustNewName(s)
+}
+
+// respond builds the response to query, or returns nil if there should be
+// none.
+func (s *Server) respond(query []byte, udp bool) []byte {
+	s.queries.Add(1)
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+		return nil
+	}
+	f, delay := s.roll()
+	if f == drop {
+		return nil
+	}
+	s.mu.Lock()
+	s.inFlight++
+	s.peak = max(s.peak, s.inFlight)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(delay)
+
+	msg.Response = true
+	msg.RecursionAvailable = true
+	msg.AuthenticData = false
+	q := msg.Questions[0]
+	name := strings.ToLower(strings.TrimSuffix(q.Name.String(), "."))
+	label, _, _ := strings.Cut(name, ".")
+	s.mu.Lock()
+	validating, stripRRSIG := !s.faults.NoValidation, s.faults.StripRRSIG
+	ignoreECS, ecsUnscoped := s.faults.IgnoreECS, s.faults.ECSUnscoped
+	identity := s.identity
+	a, aaaa := s.a, s.aaaa
+	if f == wrongAnswer {
+		a, aaaa = WrongA, WrongAAAA
+	}
+	resolveDelay := time.Duration(0)
+	if s.cached != nil && !s.cached[name] {
+		s.cached[name] = true
+		resolveDelay = s.resolveDelay
+	}
+	s.mu.Unlock()
+	time.Sleep(resolveDelay)
+	answerOptions(&msg, ignoreECS, ecsUnscoped, identity)
+	switch {
+	case q.Class == dnsmessage.ClassCHAOS:
+		if identity == "" || q.Type != dnsmessage.TypeTXT || name != "id.server" && name != "hostname.bind" {
+			msg.RCode = dnsmessage.RCodeRefused
+			break
+		}
+		msg.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassCHAOS},
+			Body:   &dnsmessage.TXTResource{TXT: []string{identity}},
+		}}
+	case f == servFail || s.servFailType(q.Type):
+		msg.RCode = dnsmessage.RCodeServerFailure
+	case f == refused:
+		msg.RCode = dnsmessage.RCodeRefused
+	case f == nxDomain || s.zone != "" && name != s.zone && !strings.HasSuffix(name, "."+s.zone):
+		msg.RCode = dnsmessage.RCodeNameError
+	case label == BogusLabel && validating:
+		msg.RCode = dnsmessage.RCodeServerFailure
+	case f == truncate && udp:
+		msg.Truncated = true
+	default:
+		msg.Answers = answers(q.Name, q.Type, a, aaaa)
+		if label == SignedLabel || label == BogusLabel {
+			msg.AuthenticData = label == SignedLabel && validating
+			if dnssecOK(msg) && !stripRRSIG {
+				msg.Answers = signed(msg.Answers)
+			}
+		}
+	}
+	if f == mismatch {
+		other, _ := dnsmessage.NewName("mismatch." + q.Name.String())
+		msg.Questions[0].Name = other
+		for i := range msg.Answers {
+			msg.Answers[i].Header.Name = other
+		}
+	}
+
+	b, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	if udp && len(b) > udpSize(msg) {
+		// Send what fits, as a real server does, so that the client can
+		// retry over TCP.
+		msg.Truncated = true
+		msg.Answers, msg.Authorities = nil, nil
+		if b, err = msg.Pack(); err != nil {
+			return nil
+		}
+	}
+	return b
+}
+
+// udpSize is the largest UDP response the sender of msg accepts: the
+// payload size in its OPT record, or 512 bytes without one.
+func udpSize(msg dnsmessage.Message) int {
+	for _, rr := range msg.Additionals {
+		if rr.Header.Type == dnsmessage.TypeOPT {
+			return max(int(rr.Header.Class), maxUDPSize)
+		}
+	}
+	return maxUDPSize
+}
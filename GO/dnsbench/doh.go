@@ -0,0 +1,156 @@
+package dnsbench
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const dnsMessageType = "application/dns-message"
+
+// dohClient sends RFC 8484 wire-format queries. Its http.Transport keeps
+// connections alive, so only the first query of a run (or of each parallel
+// connection) pays for the TLS handshake.
+type dohClient struct {
+	url       string
+	method    string
+	transport *http.Transport
+	client    *http.Client
+}
+
+func newDoHClient(provider DNSProvider, config TestConfig) *dohClient {
+	var tlsConfig *tls.Config
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     30 * time.Second,
+	}
+	method := http.MethodGet
+	if config.DoHMethod == http.MethodPost {
+		method = http.MethodPost
+	}
+	return &dohClient{
+		url:       provider.URL,
+		method:    method,
+		transport: transport,
+		client:    &http.Client{Transport: transport, Timeout: config.Timeout},
+	}
+}
+
+// exchange sends msg and fills in the DoH latency breakdown of q.
+func (c *dohClient) exchange(ctx context.Context, msg []byte, q *QueryResult) ([]byte, error) {
+	var req *http.Request
+	var err error
+	if c.method == http.MethodPost {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(msg))
+		if err == nil {
+			req.Header.Set("Content-Type", dnsMessageType)
+		}
+	} else {
+		var u *url.URL
+		u, err = url.Parse(c.url)
+		if err != nil {
+			return nil, err
+		}
+		values := u.Query()
+		values.Set("dns", base64.RawURLEncoding.EncodeToString(msg))
+		u.RawQuery = values.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dnsMessageType)
+
+	var tr dohTrace
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), tr.clientTrace()))
+
+	resp, err := c.client.Do(req)
+	tr.mu.Lock()
+	q.Reused = tr.reused
+	if tr.gotConn && !tr.reused {
+		q.Handshake = tr.handshake
+	}
+	tr.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != dnsMessageType {
+		return nil, fmt.Errorf("unexpected content type %q", ct)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if !tr.wroteRequest.IsZero() && !tr.firstByte.IsZero() {
+		q.RoundTrip = tr.firstByte.Sub(tr.wroteRequest)
+		q.Answer = time.Since(tr.firstByte)
+	}
+	return body, nil
+}
+
+// dohTrace gathers the httptrace events of one request. The transport
+// calls some of them from its own goroutines, and may still be handshaking
+// on a connection dialed for the request after the request has been given
+// another connection and returned.
+type dohTrace struct {
+	mu                      sync.Mutex
+	gotConn, reused         bool
+	handshakeStart          time.Time
+	handshake               time.Duration
+	wroteRequest, firstByte time.Time
+}
+
+func (t *dohTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.gotConn, t.reused = true, info.Reused
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.handshakeStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.handshake = time.Since(t.handshakeStart)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.firstByte = time.Now()
+		},
+	}
+}
+
+func (c *dohClient) close() {
+	c.transport.CloseIdleConnections()
+}
@@ -0,0 +1,226 @@
+package dnsbench
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// answer builds a response to query with a single A or AAAA record, or an
+// empty response with the given rcode.
+func answer(t *testing.T, query []byte, rcode dnsmessage.RCode) []byte {
+	t.Helper()
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		t.Errorf("server got malformed query: %v", err)
+		return nil
+	}
+	msg.Response = true
+	msg.RecursionAvailable = true
+	msg.RCode = rcode
+	if rcode == dnsmessage.RCodeSuccess {
+		q := msg.Questions[0]
+		var body dnsmessage.ResourceBody = &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}
+		if q.Type == dnsmessage.TypeAAAA {
+			body = &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}}
+		}
+		msg.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   body,
+		}}
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		t.Errorf("packing response: %v", err)
+	}
+	return b
+}
+
+// testTLS returns a server TLS config with the httptest certificate, which
+// is valid for example.com and 127.0.0.1, and a config for querying a
+// local server that trusts it.
+func testTLS(t *testing.T) (*tls.Config, TestConfig) {
+	t.Helper()
+	certServer := httptest.NewUnstartedServer(nil)
+	certServer.StartTLS()
+	defer certServer.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certServer.Certificate())
+	config := TestConfig{
+		TestsPerDomain: 3,
+		Timeout:        2 * time.Second,
+		Domains:        []string{"example.com", "example.net"},
+		TLSConfig:      &tls.Config{RootCAs: roots},
+	}
+	return certServer.TLS.Clone(), config
+}
+
+// connTracker counts the connections a test server accepts and closes them
+// on demand, as a server dropping idle clients would.
+type connTracker struct {
+	mu       sync.Mutex
+	accepted int
+	open     []func()
+}
+
+// add records an accepted connection and the function that closes it.
+func (c *connTracker) add(close func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accepted++
+	c.open = append(c.open, close)
+}
+
+func (c *connTracker) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accepted
+}
+
+// closeAll closes the connections accepted so far.
+func (c *connTracker) closeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, close := range c.open {
+		close()
+	}
+	c.open = nil
+}
+
+// localProvider is a provider for a server listening on addr.
+func localProvider(name string, addr net.Addr) DNSProvider {
+	host, port, _ := net.SplitHostPort(addr.String())
+	portNum, _ := strconv.Atoi(port)
+	return DNSProvider{Name: name, IP: host, Port: portNum, ServerName: "example.com"}
+}
+
+// newDoHServer starts a local RFC 8484 stand-in and returns a provider and
+// config pointing at it.
+func newDoHServer(t *testing.T, rcode dnsmessage.RCode, methods *sync.Map) (DNSProvider, TestConfig) {
+	t.Helper()
+	tlsConfig, config := testTLS(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query []byte
+		switch r.Method {
+		case http.MethodGet:
+			b, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			query = b
+		case http.MethodPost:
+			if r.Header.Get("Content-Type") != dnsMessageType {
+				http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+				return
+			}
+			query, _ = io.ReadAll(r.Body)
+		}
+		if methods != nil {
+			methods.Store(r.Method, true)
+		}
+		w.Header().Set("Content-Type", dnsMessageType)
+		w.Write(answer(t, query, rcode))
+	}))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return DNSProvider{Name: "local DoH", URL: server.URL + "/dns-query"}, config
+}
+
+func TestDoHMethods(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		t.Run(method, func(t *testing.T) {
+			var methods sync.Map
+			provider, config := newDoHServer(t, dnsmessage.RCodeSuccess, &methods)
+			config.DoHMethod = method
+
+			result := TestProvider(context.Background(), provider, config, nil)
+			if !result.Success {
+				t.Fatalf("run failed: %v", result.Errors)
+			}
+			if _, ok := methods.Load(method); !ok {
+				t.Errorf("server never saw a %s request", method)
+			}
+			if len(result.Queries) != config.TotalTests() {
+				t.Fatalf("got %d queries, want %d", len(result.Queries), config.TotalTests())
+			}
+			for i, q := range result.Queries {
+				if q.Transport != TransportDoH {
+					t.Errorf("query %d: transport %q", i, q.Transport)
+				}
+				if q.RoundTrip <= 0 || q.RoundTrip > q.Latency {
+					t.Errorf("query %d: round trip %v outside latency %v", i, q.RoundTrip, q.Latency)
+				}
+			}
+		})
+	}
+}
+
+func TestDoHHandshakeOnlyOnFirstQuery(t *testing.T) {
+	provider, config := newDoHServer(t, dnsmessage.RCodeSuccess, nil)
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if !result.Success {
+		t.Fatalf("run failed: %v", result.Errors)
+	}
+	if result.Queries[0].Handshake <= 0 {
+		t.Errorf("first query has no handshake time")
+	}
+	for i, q := range result.Queries[1:] {
+		if q.Handshake != 0 {
+			t.Errorf("query %d: handshake %v on a reused connection", i+1, q.Handshake)
+		}
+	}
+}
+
+func TestDoHParallelHandshakes(t *testing.T) {
+	provider, config := newDoHServer(t, dnsmessage.RCodeSuccess, nil)
+	config.ParallelTests = true
+	config.TestsPerDomain = 10
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if !result.Success {
+		t.Fatalf("run failed: %v", result.Errors)
+	}
+	for i, q := range result.Queries {
+		if q.Reused && q.Handshake != 0 {
+			t.Errorf("query %d: handshake %v on a reused connection", i, q.Handshake)
+		}
+	}
+}
+
+func TestDoHErrorRcode(t *testing.T) {
+	provider, config := newDoHServer(t, dnsmessage.RCodeServerFailure, nil)
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if result.Success {
+		t.Fatal("run succeeded against a failing server")
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "SERVFAIL") {
+		t.Errorf("errors = %q, want SERVFAIL", result.Errors)
+	}
+}
+
+func TestDoHUntrustedCertificate(t *testing.T) {
+	provider, config := newDoHServer(t, dnsmessage.RCodeSuccess, nil)
+	config.TLSConfig = nil
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if result.Success {
+		t.Fatal("run succeeded against a server with an untrusted certificate")
+	}
+}
@@ -0,0 +1,105 @@
+package dnsbench
+
+import (
+	"bufio"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// ReadDomains reads a list of domains from plain text with one per line or
+// from a CSV such as a top-sites list ("rank,domain"). Blank lines,
+// comments starting with '#', header rows and duplicates are skipped, and
+// URLs are reduced to their host name. At most limit domains are returned,
+// or all of them when limit is 0.
+func ReadDomains(r io.Reader, limit int) ([]string, error) {
+	domains, _, err := ReadDomainTypes(r, limit)
+	return domains, err
+}
+
+// ReadDomainTypes is ReadDomains, but also returns the record types listed
+// after a domain on its line, such as "example.com MX TXT", in the form of
+// TestConfig.DomainTypes.
+func ReadDomainTypes(r io.Reader, limit int) ([]string, map[string][]string, error) {
+	var domains []string
+	types := make(map[string][]string)
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ';' || r == '\t' || r == ' '
+		})
+		for i, f := range fields {
+			d := normalizeDomain(f)
+			if !isDomain(d) {
+				continue
+			}
+			if !seen[d] {
+				seen[d] = true
+				domains = append(domains, d)
+			}
+			for _, t := range fields[i+1:] {
+				t = strings.ToUpper(t)
+				if ValidQueryType(t) && !contains(types[d], t) {
+					types[d] = append(types[d], t)
+				}
+			}
+			break
+		}
+		if limit > 0 && len(domains) >= limit {
+			break
+		}
+	}
+	return domains, types, scanner.Err()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDomain lower-cases s and strips quotes, a URL scheme, path and
+// port, and the trailing dot.
+func normalizeDomain(s string) string {
+	s = strings.ToLower(strings.Trim(s, `"' `))
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+	if i := strings.IndexAny(s, "/?#"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSuffix(s, ".")
+}
+
+// isDomain reports whether s is a plausible host name with at least two
+// labels. IP addresses are not domains.
+func isDomain(s string) bool {
+	if len(s) > 253 || !strings.Contains(s, ".") {
+		return false
+	}
+	if _, err := netip.ParseAddr(s); err == nil {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package dnsbench
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDomainsText(t *testing.T) {
+	input := `# our services
+www.example.com
+  API.Example.com.
+
+https://status.example.com/health
+www.example.com
+not a domain
+192.0.2.1
+`
+	got, err := ReadDomains(strings.NewReader(input), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"www.example.com", "api.example.com", "status.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadDomains = %q, want %q", got, want)
+	}
+}
+
+func TestReadDomainsTopSitesCSV(t *testing.T) {
+	input := "rank,domain\r\n1,google.com\r\n2,\"youtube.com\"\r\n3,facebook.com\r\n4,baidu.com\r\n"
+	got, err := ReadDomains(strings.NewReader(input), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"google.com", "youtube.com", "facebook.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadDomains = %q, want %q", got, want)
+	}
+}
+
+func TestReadDomainTypes(t *testing.T) {
+	input := "example.com MX txt MX\n_sip._tcp.example.com SRV\nwww.example.com\nhttps://api.example.com/ HTTPS bogus\n"
+	domains, types, err := ReadDomainTypes(strings.NewReader(input), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"example.com", "_sip._tcp.example.com", "www.example.com", "api.example.com"}; !reflect.DeepEqual(domains, want) {
+		t.Errorf("domains = %q, want %q", domains, want)
+	}
+	want := map[string][]string{
+		"example.com":           {"MX", "TXT"},
+		"_sip._tcp.example.com": {"SRV"},
+		"api.example.com":       {"HTTPS"},
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("types = %q, want %q", types, want)
+	}
+}
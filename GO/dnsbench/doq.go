@@ -0,0 +1,217 @@
+package dnsbench
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// doqClient sends RFC 9250 DNS-over-QUIC queries, one stream per query.
+// Normally all queries share one connection. With TestConfig.DoQReconnect
+// every query dials a new connection, resuming the previous TLS session so
+// that servers supporting it answer over 0-RTT.
+type doqClient struct {
+	addr       string
+	tlsConfig  *tls.Config
+	quicConfig *quic.Config
+	reconnect  bool
+
+	mu   sync.Mutex
+	conn quic.EarlyConnection
+	// dialing is closed when the dial in progress for conn finishes.
+	dialing chan struct{}
+}
+
+func newDoQClient(provider DNSProvider, config TestConfig) *doqClient {
+	addr := config.serverAddr(provider, TransportDoQ)
+	tlsConfig := &tls.Config{}
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	tlsConfig.ServerName = provider.ServerName
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tlsConfig.NextProtos = []string{"doq"}
+	tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	return &doqClient{
+		addr:       addr,
+		tlsConfig:  tlsConfig,
+		quicConfig: &quic.Config{HandshakeIdleTimeout: config.Timeout},
+		reconnect:  config.DoQReconnect,
+	}
+}
+
+func (c *doqClient) exchange(ctx context.Context, msg []byte, q *QueryResult) ([]byte, error) {
+	if c.reconnect {
+		conn, handshake, err := c.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.CloseWithError(0, "")
+		resp, err := roundTrip(ctx, conn, msg)
+		if err != nil {
+			return nil, err
+		}
+		recordHandshake(ctx, conn, handshake, q)
+		return resp, nil
+	}
+
+	conn, handshake, err := c.shared(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := roundTrip(ctx, conn, msg)
+	if err != nil && handshake == nil && ctx.Err() == nil {
+		// The server may have closed the connection, or it timed out
+		// while idle; try once more on a new one.
+		c.drop(conn)
+		if conn, handshake, err = c.shared(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = roundTrip(ctx, conn, msg)
+	}
+	if err != nil {
+		if conn.Context().Err() != nil {
+			c.drop(conn)
+		}
+		return nil, err
+	}
+	if handshake != nil {
+		recordHandshake(ctx, conn, handshake, q)
+	} else {
+		q.Reused = true
+	}
+	return resp, nil
+}
+
+// shared returns the connection queries share, dialing it if there is
+// none or it has been closed. The handshake channel is nil unless this
+// call dialed it. While one query dials, the others wait for it rather
+// than opening connections of their own.
+func (c *doqClient) shared(ctx context.Context) (quic.EarlyConnection, <-chan time.Duration, error) {
+	for {
+		c.mu.Lock()
+		if c.conn != nil && c.conn.Context().Err() != nil {
+			c.conn = nil
+		}
+		if conn := c.conn; conn != nil {
+			c.mu.Unlock()
+			return conn, nil, nil
+		}
+		if dialing := c.dialing; dialing != nil {
+			c.mu.Unlock()
+			select {
+			case <-dialing:
+				continue
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+		dialing := make(chan struct{})
+		c.dialing = dialing
+		c.mu.Unlock()
+
+		conn, handshake, err := c.dial(ctx)
+		c.mu.Lock()
+		c.dialing = nil
+		if err == nil {
+			c.conn = conn
+		}
+		c.mu.Unlock()
+		close(dialing)
+		return conn, handshake, err
+	}
+}
+
+// drop closes conn and, if it is still the shared connection, forgets it
+// so that the next query dials a new one.
+func (c *doqClient) drop(conn quic.EarlyConnection) {
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.mu.Unlock()
+	conn.CloseWithError(0, "")
+}
+
+// dial starts a connection and returns as soon as it can carry data, which
+// with a resumed session is before the handshake has finished. The channel
+// receives the time taken to complete the handshake.
+func (c *doqClient) dial(ctx context.Context) (quic.EarlyConnection, <-chan time.Duration, error) {
+	start := time.Now()
+	conn, err := quic.DialAddrEarly(ctx, c.addr, c.tlsConfig, c.quicConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	handshake := make(chan time.Duration, 1)
+	go func() {
+		select {
+		case <-conn.HandshakeComplete():
+			handshake <- time.Since(start)
+		case <-conn.Context().Done():
+		}
+	}()
+	return conn, handshake, nil
+}
+
+func recordHandshake(ctx context.Context, conn quic.EarlyConnection, handshake <-chan time.Duration, q *QueryResult) {
+	select {
+	case q.Handshake = <-handshake:
+		q.ZeroRTT = conn.ConnectionState().Used0RTT
+	case <-ctx.Done():
+	}
+}
+
+func roundTrip(ctx context.Context, conn quic.EarlyConnection, msg []byte) ([]byte, error) {
+	resp, err := sendStream(ctx, conn, msg)
+	if errors.Is(err, quic.Err0RTTRejected) {
+		// The server refused early data; resend once the handshake is done.
+		next := conn.NextConnection()
+		if next == nil {
+			return nil, err
+		}
+		resp, err = sendStream(ctx, next, msg)
+	}
+	return resp, err
+}
+
+func sendStream(ctx context.Context, conn quic.Connection, msg []byte) ([]byte, error) {
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CancelRead(0)
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { stream.SetDeadline(time.Now()) })
+	defer stop()
+	if err := writeStreamMsg(stream, msg); err != nil {
+		return nil, err
+	}
+	// Closing the send side tells the server the query is complete.
+	if err := stream.Close(); err != nil {
+		return nil, err
+	}
+	resp, err := readStreamMsg(stream)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return resp, err
+}
+
+func (c *doqClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.CloseWithError(0, "")
+		c.conn = nil
+	}
+}
@@ -0,0 +1,148 @@
+package dnsbench
+
+import (
+	"context"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newDoQServer starts a local RFC 9250 stand-in that accepts 0-RTT and
+// returns a provider and config pointing at it and the connections it
+// accepts.
+func newDoQServer(t *testing.T) (DNSProvider, TestConfig, *connTracker) {
+	t.Helper()
+	tlsConfig, config := testTLS(t)
+	config.UseQUIC = true
+	tlsConfig.NextProtos = []string{"doq"}
+	ln, err := quic.ListenAddrEarly("127.0.0.1:0", tlsConfig, &quic.Config{Allow0RTT: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	conns := new(connTracker)
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			conns.add(func() { conn.CloseWithError(0, "") })
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					go func() {
+						defer stream.Close()
+						query, err := readStreamMsg(stream)
+						if err != nil {
+							return
+						}
+						var msg dnsmessage.Message
+						if err := msg.Unpack(query); err != nil || msg.ID != 0 {
+							t.Errorf("DoQ query has ID %d, want 0", msg.ID)
+						}
+						writeStreamMsg(stream, answer(t, query, dnsmessage.RCodeSuccess))
+					}()
+				}
+			}()
+		}
+	}()
+	return localProvider("local DoQ", ln.Addr()), config, conns
+}
+
+func TestDoQSharedConnection(t *testing.T) {
+	provider, config, _ := newDoQServer(t)
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if !result.Success || len(result.Errors) != 0 {
+		t.Fatalf("run failed: %v", result.Errors)
+	}
+	first := result.Queries[0]
+	if first.Transport != TransportDoQ || first.Reused || first.ZeroRTT || first.Handshake <= 0 {
+		t.Errorf("first query = %+v, want a new 1-RTT connection", first)
+	}
+	for i, q := range result.Queries[1:] {
+		if !q.Reused {
+			t.Errorf("query %d did not reuse the connection", i+1)
+		}
+	}
+	if result.OneRTTLatency != first.Latency || result.HandshakeLatency != first.Handshake {
+		t.Errorf("1-RTT latency %v / handshake %v, want %v / %v",
+			result.OneRTTLatency, result.HandshakeLatency, first.Latency, first.Handshake)
+	}
+}
+
+func TestDoQZeroRTT(t *testing.T) {
+	provider, config, _ := newDoQServer(t)
+	config.DoQReconnect = true
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if !result.Success || len(result.Errors) != 0 {
+		t.Fatalf("run failed: %v", result.Errors)
+	}
+	if result.Queries[0].ZeroRTT {
+		t.Errorf("first connection used 0-RTT without a session ticket")
+	}
+	var resumed int
+	for _, q := range result.Queries[1:] {
+		if q.Reused {
+			t.Errorf("query reused a connection despite DoQReconnect")
+		}
+		if q.ZeroRTT {
+			resumed++
+		}
+	}
+	if resumed == 0 {
+		t.Fatal("no query was resumed with 0-RTT")
+	}
+	if result.ZeroRTTLatency <= 0 || result.OneRTTLatency <= 0 {
+		t.Errorf("ZeroRTTLatency = %v, OneRTTLatency = %v, want both set", result.ZeroRTTLatency, result.OneRTTLatency)
+	}
+}
+
+func TestDoQParallel(t *testing.T) {
+	provider, config, _ := newDoQServer(t)
+	config.ParallelTests = true
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if !result.Success || len(result.Errors) != 0 {
+		t.Fatalf("run failed: %v", result.Errors)
+	}
+}
+
+func TestDoQRedialsClosedConnection(t *testing.T) {
+	provider, config, conns := newDoQServer(t)
+	c := newDoQClient(provider, config)
+	defer c.close()
+	msg, err := newQuery(0, "example.com", dnsmessage.TypeA, queryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchange := func() QueryResult {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+		defer cancel()
+		var q QueryResult
+		if _, err := c.exchange(ctx, msg, &q); err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		return q
+	}
+
+	exchange()
+	if q := exchange(); !q.Reused {
+		t.Errorf("second query did not reuse the connection")
+	}
+	conns.closeAll()
+	if q := exchange(); q.Reused || q.Handshake <= 0 {
+		t.Errorf("query after the server closed the connection = %+v, want a new connection", q)
+	}
+	if q := exchange(); !q.Reused {
+		t.Errorf("query did not reuse the new connection")
+	}
+}
@@ -0,0 +1,103 @@
+package dnsbench
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+// dotClient sends RFC 7858 DNS-over-TLS queries. Connections are kept in an
+// idle pool so that sequential queries reuse one connection, while parallel
+// queries open as many as they need.
+type dotClient struct {
+	addr      string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+
+	mu   sync.Mutex
+	idle []*tls.Conn
+}
+
+func newDoTClient(provider DNSProvider, config TestConfig) *dotClient {
+	addr := config.serverAddr(provider, TransportDoT)
+	tlsConfig := &tls.Config{}
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	tlsConfig.ServerName = provider.ServerName
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	return &dotClient{addr: addr, tlsConfig: tlsConfig, timeout: config.Timeout}
+}
+
+func (c *dotClient) exchange(ctx context.Context, msg []byte, q *QueryResult) ([]byte, error) {
+	if conn := c.get(); conn != nil {
+		resp, err := c.roundTrip(ctx, conn, msg)
+		if err == nil || ctx.Err() != nil {
+			q.Reused = true
+			return resp, err
+		}
+		// The server may have closed the connection while it was idle;
+		// try once more on a new one.
+	}
+
+	start := time.Now()
+	d := tls.Dialer{NetDialer: &net.Dialer{Timeout: c.timeout}, Config: c.tlsConfig}
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	q.Handshake = time.Since(start)
+	return c.roundTrip(ctx, nc.(*tls.Conn), msg)
+}
+
+// roundTrip sends msg over conn and reads the response. conn goes back to
+// the idle pool if that worked and is closed otherwise.
+func (c *dotClient) roundTrip(ctx context.Context, conn *tls.Conn, msg []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	if err := writeStreamMsg(conn, msg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := readStreamMsg(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.put(conn)
+	return resp, nil
+}
+
+func (c *dotClient) get() *tls.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle) == 0 {
+		return nil
+	}
+	conn := c.idle[len(c.idle)-1]
+	c.idle = c.idle[:len(c.idle)-1]
+	return conn
+}
+
+func (c *dotClient) put(conn *tls.Conn) {
+	conn.SetDeadline(time.Time{})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.idle = append(c.idle, conn)
+}
+
+func (c *dotClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.idle {
+		conn.Close()
+	}
+	c.idle = nil
+}
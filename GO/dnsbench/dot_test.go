@@ -0,0 +1,130 @@
+package dnsbench
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newDoTServer starts a local RFC 7858 stand-in and returns a provider and
+// config pointing at it and the connections it accepts.
+func newDoTServer(t *testing.T) (DNSProvider, TestConfig, *connTracker) {
+	t.Helper()
+	tlsConfig, config := testTLS(t)
+	config.UseTLS = true
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	conns := new(connTracker)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns.add(func() { conn.Close() })
+			go func() {
+				defer conn.Close()
+				for {
+					query, err := readStreamMsg(conn)
+					if err != nil {
+						return
+					}
+					if err := writeStreamMsg(conn, answer(t, query, dnsmessage.RCodeSuccess)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return localProvider("local DoT", ln.Addr()), config, conns
+}
+
+func TestDoTConnectionReuse(t *testing.T) {
+	provider, config, conns := newDoTServer(t)
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if !result.Success {
+		t.Fatalf("run failed: %v", result.Errors)
+	}
+	if n := conns.count(); n != 1 {
+		t.Errorf("sequential run opened %d connections, want 1", n)
+	}
+	first := result.Queries[0]
+	if first.Transport != TransportDoT || first.Reused || first.Handshake <= 0 {
+		t.Errorf("first query = %+v, want a new DoT connection with handshake time", first)
+	}
+	for i, q := range result.Queries[1:] {
+		if !q.Reused || q.Handshake != 0 {
+			t.Errorf("query %d did not reuse the connection", i+1)
+		}
+	}
+	if result.FirstQueryLatency != first.Latency {
+		t.Errorf("FirstQueryLatency = %v, want %v", result.FirstQueryLatency, first.Latency)
+	}
+	if result.ReusedLatency <= 0 {
+		t.Errorf("ReusedLatency not set")
+	}
+}
+
+func TestDoTParallel(t *testing.T) {
+	provider, config, _ := newDoTServer(t)
+	config.ParallelTests = true
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if !result.Success || len(result.Errors) != 0 {
+		t.Fatalf("run failed: %v", result.Errors)
+	}
+}
+
+func TestDoTServerName(t *testing.T) {
+	provider, config, _ := newDoTServer(t)
+
+	// An empty server name falls back to the IP, which the certificate covers.
+	provider.ServerName = ""
+	if result := TestProvider(context.Background(), provider, config, nil); !result.Success {
+		t.Errorf("IP server name rejected: %v", result.Errors)
+	}
+
+	provider.ServerName = "dns.example.org"
+	if result := TestProvider(context.Background(), provider, config, nil); result.Success {
+		t.Errorf("certificate accepted for the wrong server name")
+	}
+}
+
+func TestDoTRedialsClosedConnection(t *testing.T) {
+	provider, config, conns := newDoTServer(t)
+	c := newDoTClient(provider, config)
+	defer c.close()
+	msg, err := newQuery(0, "example.com", dnsmessage.TypeA, queryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchange := func() QueryResult {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+		defer cancel()
+		var q QueryResult
+		if _, err := c.exchange(ctx, msg, &q); err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		return q
+	}
+
+	exchange()
+	conns.closeAll()
+	if q := exchange(); q.Reused || q.Handshake <= 0 {
+		t.Errorf("query after the server closed the connection = %+v, want a new connection", q)
+	}
+	if q := exchange(); !q.Reused {
+		t.Errorf("query did not reuse the new connection")
+	}
+	if n := conns.count(); n != 2 {
+		t.Errorf("opened %d connections, want 2", n)
+	}
+}
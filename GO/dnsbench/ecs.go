@@ -0,0 +1,195 @@
+package dnsbench
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// optionECS is the EDNS option code of EDNS Client Subnet (RFC 7871).
+const optionECS = 8
+
+// ecsOption encodes subnet as an EDNS Client Subnet option.
+func ecsOption(subnet netip.Prefix) dnsmessage.Option {
+	family := uint16(1)
+	if subnet.Addr().Is6() {
+		family = 2
+	}
+	bits := subnet.Bits()
+	data := binary.BigEndian.AppendUint16(nil, family)
+	data = append(data, byte(bits), 0)
+	data = append(data, subnet.Masked().Addr().AsSlice()[:(bits+7)/8]...)
+	return dnsmessage.Option{Code: optionECS, Data: data}
+}
+
+// ecsScope returns the scope prefix length of the EDNS Client Subnet option
+// in msg, if it has one.
+func ecsScope(msg *dnsmessage.Message) (int, bool) {
+	for _, rr := range msg.Additionals {
+		opt, ok := rr.Body.(*dnsmessage.OPTResource)
+		if !ok {
+			continue
+		}
+		for _, o := range opt.Options {
+			if o.Code == optionECS && len(o.Data) >= 4 {
+				return int(o.Data[3]), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ParseSubnet parses a TestConfig.ClientSubnet. A bare address stands for
+// its /24 or /56, the prefixes resolvers commonly send.
+func ParseSubnet(s string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid client subnet %q", s)
+	}
+	bits := 56
+	if addr.Is4() {
+		bits = 24
+	}
+	return addr.Prefix(bits)
+}
+
+// ECSSupport sums up how a provider treated the EDNS Client Subnet option
+// sent with TestConfig.ClientSubnet.
+type ECSSupport struct {
+	// Responses is the number of responses to queries with the option,
+	// Echoed the number that carried it back, and Scoped the number of
+	// those with a non-zero scope, meaning the answer was chosen for the
+	// subnet and so the provider passed it on to the authoritative server.
+	Responses, Echoed, Scoped int
+	// MaxScope is the largest scope prefix length returned.
+	MaxScope int
+}
+
+// Forwards reports whether the provider passes the subnet upstream.
+func (e ECSSupport) Forwards() bool {
+	return e.Scoped > 0
+}
+
+func (e ECSSupport) String() string {
+	switch {
+	case e.Responses == 0:
+		return "unknown"
+	case e.Echoed == 0:
+		return "ignored"
+	case e.Scoped == 0:
+		return "not forwarded (scope 0)"
+	default:
+		return fmt.Sprintf("forwarded (scope up to /%d in %d of %d answers)", e.MaxScope, e.Scoped, e.Responses)
+	}
+}
+
+func summarizeECS(queries []QueryResult) *ECSSupport {
+	var e ECSSupport
+	for _, q := range queries {
+		if q.Rcode == "" {
+			continue
+		}
+		e.Responses++
+		if q.ECSEchoed {
+			e.Echoed++
+			if q.ECSScope > 0 {
+				e.Scoped++
+			}
+			if q.ECSScope > e.MaxScope {
+				e.MaxScope = q.ECSScope
+			}
+		}
+	}
+	return &e
+}
+
+// AnswerGroup is a set of providers whose answers for a domain came from
+// the same networks.
+type AnswerGroup struct {
+	Providers []string
+	// Networks are the /24 (IPv4) and /48 (IPv6) networks of the addresses
+	// they returned, sorted.
+	Networks []string
+}
+
+// DomainAnswers compares the answers the providers returned for a domain.
+type DomainAnswers struct {
+	Domain string
+	// Groups are largest first. A single group means every provider was
+	// sent to the same place.
+	Groups []AnswerGroup
+}
+
+// CompareAnswers groups the providers of a run, per domain, by the networks
+// of the A and AAAA addresses they returned. CDNs answer according to
+// where the query seems to come from: the client subnet for providers that
+// forward ECS, and otherwise the provider's own location. A provider
+// outside the group of the local network's resolver, if that was tested,
+// is therefore likely to send clients to more distant servers. Domains
+// answered by fewer than two providers are left out.
+func CompareAnswers(results []TestResult) []DomainAnswers {
+	// networks[domain][provider] is the set of networks returned.
+	networks := make(map[string]map[string]map[string]bool)
+	for _, r := range results {
+		for _, q := range r.Queries {
+			if q.Uncached || !q.Success || len(q.Addrs) == 0 {
+				continue
+			}
+			if networks[q.Domain] == nil {
+				networks[q.Domain] = make(map[string]map[string]bool)
+			}
+			set := networks[q.Domain][r.Provider.Name]
+			if set == nil {
+				set = make(map[string]bool)
+				networks[q.Domain][r.Provider.Name] = set
+			}
+			for _, s := range q.Addrs {
+				if addr, err := netip.ParseAddr(s); err == nil {
+					set[network(addr).String()] = true
+				}
+			}
+		}
+	}
+
+	var out []DomainAnswers
+	for domain, byProvider := range networks {
+		if len(byProvider) < 2 {
+			continue
+		}
+		groups := make(map[string]*AnswerGroup)
+		for provider, set := range byProvider {
+			var nets []string
+			for n := range set {
+				nets = append(nets, n)
+			}
+			sort.Strings(nets)
+			key := strings.Join(nets, " ")
+			if groups[key] == nil {
+				groups[key] = &AnswerGroup{Networks: nets}
+			}
+			groups[key].Providers = append(groups[key].Providers, provider)
+		}
+		d := DomainAnswers{Domain: domain}
+		for _, g := range groups {
+			sort.Strings(g.Providers)
+			d.Groups = append(d.Groups, *g)
+		}
+		sort.Slice(d.Groups, func(i, j int) bool {
+			a, b := d.Groups[i], d.Groups[j]
+			if len(a.Providers) != len(b.Providers) {
+				return len(a.Providers) > len(b.Providers)
+			}
+			return a.Providers[0] < b.Providers[0]
+		})
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Domain < out[j].Domain })
+	return out
+}
@@ -0,0 +1,116 @@
+package dnsbench
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench/dnstest"
+)
+
+func TestECSOption(t *testing.T) {
+	tests := []struct {
+		subnet string
+		data   []byte
+	}{
+		{"198.51.100.7", []byte{0, 1, 24, 0, 198, 51, 100}},
+		{"198.51.100.0/22", []byte{0, 1, 22, 0, 198, 51, 100}},
+		{"2001:db8:1234:5678::1", []byte{0, 2, 56, 0, 0x20, 0x01, 0x0d, 0xb8, 0x12, 0x34, 0x56}},
+		{"0.0.0.0/0", []byte{0, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		p, err := ParseSubnet(tt.subnet)
+		if err != nil {
+			t.Errorf("%s: %v", tt.subnet, err)
+			continue
+		}
+		if o := ecsOption(p); o.Code != optionECS || !bytes.Equal(o.Data, tt.data) {
+			t.Errorf("%s: option %d % x, want % x", tt.subnet, o.Code, o.Data, tt.data)
+		}
+	}
+	if _, err := ParseSubnet("nearby"); err == nil {
+		t.Error("invalid subnet accepted")
+	}
+}
+
+func TestClientSubnet(t *testing.T) {
+	tests := []struct {
+		name    string
+		faults  dnstest.Faults
+		echoed  bool
+		scope   int
+		summary string
+	}{
+		{"forwarding", dnstest.Faults{}, true, 24, "forwarded (scope up to /24 in 2 of 2 answers)"},
+		{"unscoped", dnstest.Faults{ECSUnscoped: true}, true, 0, "not forwarded (scope 0)"},
+		{"ignoring", dnstest.Faults{IgnoreECS: true}, false, 0, "ignored"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, _ := newMockServer(t, tt.name, "example.com", tt.faults)
+			config := TestConfig{
+				Domains:        []string{"www.example.com"},
+				TestsPerDomain: 2,
+				Timeout:        time.Second,
+				ClientSubnet:   "198.51.100.7",
+			}
+			r := TestProvider(context.Background(), provider, config, nil)
+			if !r.Success || r.ECS == nil {
+				t.Fatalf("success %v, ECS %v, errors %v", r.Success, r.ECS, r.Errors)
+			}
+			for _, q := range r.Queries {
+				if q.ECSEchoed != tt.echoed || q.ECSScope != tt.scope {
+					t.Errorf("ECS echoed %v with scope %d, want %v and %d", q.ECSEchoed, q.ECSScope, tt.echoed, tt.scope)
+				}
+			}
+			if got := r.ECS.String(); got != tt.summary || r.ECS.Forwards() != (tt.scope > 0) {
+				t.Errorf("ECS = %q, want %q", got, tt.summary)
+			}
+		})
+	}
+}
+
+func TestClientSubnetInvalid(t *testing.T) {
+	provider, s := newMockServer(t, "local", "example.com", dnstest.Faults{})
+	config := TestConfig{Domains: []string{"www.example.com"}, TestsPerDomain: 2, Timeout: time.Second, ClientSubnet: "nearby"}
+	r := TestProvider(context.Background(), provider, config, nil)
+	if r.Success || len(r.Errors) == 0 || !strings.Contains(r.Errors[0], "client subnet") || s.Queries() != 0 {
+		t.Errorf("success %v, errors %v, %d queries sent", r.Success, r.Errors, s.Queries())
+	}
+}
+
+func TestCompareAnswers(t *testing.T) {
+	near1, _ := newMockServer(t, "near 1", "", dnstest.Faults{})
+	near2, _ := newMockServer(t, "near 2", "", dnstest.Faults{})
+	far, _ := newMockServer(t, "far", "", dnstest.Faults{WrongAnswerRate: 1})
+	config := TestConfig{
+		Domains:        []string{"www.netflix.com", "www.amazon.com"},
+		DomainTypes:    map[string][]string{"www.amazon.com": {"A", "AAAA"}},
+		TestsPerDomain: 2,
+		Timeout:        time.Second,
+	}
+	results := Run(context.Background(), []DNSProvider{far, near1, near2}, config, nil)
+	// A provider that answered alone is not compared.
+	results = append(results, TestResult{
+		Provider: DNSProvider{Name: "lone"},
+		Queries:  []QueryResult{{Domain: "www.example.com", Success: true, Addrs: []string{"192.0.2.1"}}},
+	})
+
+	got := CompareAnswers(results)
+	want := []DomainAnswers{
+		{Domain: "www.amazon.com", Groups: []AnswerGroup{
+			{Providers: []string{"near 1", "near 2"}, Networks: []string{"192.0.2.0/24", "2001:db8::/48"}},
+			{Providers: []string{"far"}, Networks: []string{"2001:db8:bad::/48", "203.0.113.0/24"}},
+		}},
+		{Domain: "www.netflix.com", Groups: []AnswerGroup{
+			{Providers: []string{"near 1", "near 2"}, Networks: []string{"192.0.2.0/24"}},
+			{Providers: []string{"far"}, Networks: []string{"203.0.113.0/24"}},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CompareAnswers = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+package dnsbench
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report is a complete benchmark run: when it started, how it was
+// configured and what every provider returned.
+type Report struct {
+	StartedAt time.Time
+	Config    TestConfig
+	Results   []TestResult
+}
+
+// Export formats.
+const (
+	// FormatJSON writes the whole Report as one indented JSON document.
+	FormatJSON = "json"
+	// FormatNDJSON writes one JSON object per line: a "run" record with the
+	// configuration, a "result" record per provider and a "query" record
+	// per query.
+	FormatNDJSON = "ndjson"
+	// FormatCSV writes one row per provider with its summary statistics.
+	FormatCSV = "csv"
+)
+
+// Formats lists the supported export formats.
+var Formats = []string{FormatJSON, FormatNDJSON, FormatCSV}
+
+// Export writes report to w in the given format.
+func Export(w io.Writer, report Report, format string) error {
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatNDJSON:
+		return exportNDJSON(w, report)
+	case FormatCSV:
+		return exportCSV(w, report)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+type ndjsonRecord struct {
+	Record    string
+	StartedAt time.Time
+	Config    *TestConfig  `json:",omitempty"`
+	Result    *TestResult  `json:",omitempty"`
+	Query     *QueryResult `json:",omitempty"`
+}
+
+func exportNDJSON(w io.Writer, report Report) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(ndjsonRecord{Record: "run", StartedAt: report.StartedAt, Config: &report.Config}); err != nil {
+		return err
+	}
+	for _, r := range report.Results {
+		summary := r
+		summary.Queries = nil
+		if err := enc.Encode(ndjsonRecord{Record: "result", StartedAt: report.StartedAt, Result: &summary}); err != nil {
+			return err
+		}
+	}
+	for _, r := range report.Results {
+		for i := range r.Queries {
+			if err := enc.Encode(ndjsonRecord{Record: "query", StartedAt: report.StartedAt, Query: &r.Queries[i]}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func exportCSV(w io.Writer, report Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"Started", "Provider", "Address", "Transport", "Latency (ms)", "Success", "Tests Done", "Total Tests",
+		"Min (ms)", "Median (ms)", "P90 (ms)", "P95 (ms)", "P99 (ms)", "Max (ms)", "StdDev (ms)", "Jitter (ms)", "Loss (%)",
+		"Uncached Latency (ms)", "First Query (ms)", "Reused (ms)", "Handshake (ms)", "0-RTT (ms)", "1-RTT (ms)", "DNSSEC", "ECS", "Instance", "Findings", "Errors",
+	})
+	for _, r := range report.Results {
+		var findings []string
+		for _, f := range r.Findings {
+			findings = append(findings, f.String())
+		}
+		var dnssec, ecs, instance string
+		if r.DNSSEC != nil {
+			dnssec = r.DNSSEC.String()
+		}
+		if r.ECS != nil {
+			ecs = r.ECS.String()
+		}
+		if r.Identity != nil {
+			instance = r.Identity.Instance()
+		}
+		cw.Write([]string{
+			report.StartedAt.Format(time.RFC3339),
+			r.Provider.Name,
+			r.Provider.Address(),
+			string(report.Config.transport(r.Provider)),
+			millis(r.Latency),
+			strconv.FormatBool(r.Success),
+			strconv.Itoa(r.TestsDone),
+			strconv.Itoa(r.TotalTests),
+			millis(r.Min), millis(r.Median), millis(r.P90), millis(r.P95), millis(r.P99), millis(r.Max),
+			millis(r.StdDev), millis(r.Jitter),
+			strconv.FormatFloat(r.Loss, 'f', 1, 64),
+			millis(r.UncachedLatency),
+			millisIfSet(r.FirstQueryLatency),
+			millisIfSet(r.ReusedLatency),
+			millisIfSet(r.HandshakeLatency),
+			millisIfSet(r.ZeroRTTLatency),
+			millisIfSet(r.OneRTTLatency),
+			dnssec,
+			ecs,
+			instance,
+			strings.Join(findings, "; "),
+			strings.Join(r.Errors, "; "),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func millis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// millisIfSet leaves figures that only some transports have empty for the
+// others.
+func millisIfSet(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return millis(d)
+}
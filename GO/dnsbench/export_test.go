@@ -0,0 +1,126 @@
+package dnsbench
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testReport() Report {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	queries := []QueryResult{
+		{Provider: "v6", Domain: "www.example.com", QueryType: "AAAA", Transport: TransportUDP, TimeStamp: start,
+			Latency: 12 * time.Millisecond, Success: true, Rcode: "NOERROR", Addrs: []string{"2001:db8::1"}},
+		{Provider: "v6", Domain: "www.example.com", QueryType: "AAAA", Transport: TransportUDP, TimeStamp: start,
+			Latency: 3 * time.Second, Error: "timeout"},
+	}
+	config := DefaultConfig()
+	config.UseIPv6 = true
+	return Report{
+		StartedAt: start,
+		Config:    config,
+		Results: []TestResult{{
+			Provider:      DNSProvider{Name: "v6", IP: "192.0.2.53", IPv6: "2001:db8::53"},
+			Latency:       12 * time.Millisecond,
+			Success:       true,
+			TestsDone:     2,
+			TotalTests:    2,
+			Errors:        []string{"timeout"},
+			TimeStamp:     start,
+			Stats:         computeStats(queries),
+			Findings:      []Finding{{Kind: FindingWrongAnswer, Domain: "www.example.com", Detail: "returned 2001:db8::1"}},
+			DNSSEC:        &DNSSECSupport{AuthenticData: true, RejectsBogus: true, RRSIG: true},
+			ECS:           &ECSSupport{Responses: 1},
+			Identity:      &ResolverIdentity{IDServer: "fra02"},
+			ReusedLatency: 12 * time.Millisecond,
+			OneRTTLatency: 40 * time.Millisecond,
+			Queries:       queries,
+		}},
+	}
+}
+
+func TestExportJSONRoundTrip(t *testing.T) {
+	report := testReport()
+	var buf bytes.Buffer
+	if err := Export(&buf, report, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, report) {
+		t.Errorf("JSON round trip changed the report:\n got %+v\nwant %+v", got, report)
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, testReport(), FormatNDJSON); err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var rec ndjsonRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		kinds = append(kinds, rec.Record)
+		if rec.Result != nil && len(rec.Result.Queries) != 0 {
+			t.Errorf("result record repeats the raw queries")
+		}
+	}
+	if want := []string{"run", "result", "query", "query"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("records = %v, want %v", kinds, want)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, testReport(), FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want header and one provider", len(rows))
+	}
+	row := make(map[string]string)
+	for i, h := range rows[0] {
+		row[h] = rows[1][i]
+	}
+	want := map[string]string{
+		"Provider":       "v6",
+		"Address":        "192.0.2.53",
+		"Latency (ms)":   "12.000",
+		"Success":        "true",
+		"Tests Done":     "2",
+		"Total Tests":    "2",
+		"Loss (%)":       "50.0",
+		"DNSSEC":         "validating",
+		"ECS":            "ignored",
+		"Instance":       "fra02",
+		"Reused (ms)":    "12.000",
+		"Handshake (ms)": "",
+		"1-RTT (ms)":     "40.000",
+		"Findings":       "wrong answer for www.example.com: returned 2001:db8::1",
+	}
+	for k, v := range want {
+		if row[k] != v {
+			t.Errorf("%s = %q, want %q", k, row[k], v)
+		}
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	if err := Export(&bytes.Buffer{}, testReport(), "xml"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
@@ -0,0 +1,267 @@
+package dnsbench
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench/dnstest"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newMockServer starts a dnstest server for zone and returns a provider
+// pointing at it.
+func newMockServer(t *testing.T, name, zone string, faults dnstest.Faults) (DNSProvider, *dnstest.Server) {
+	t.Helper()
+	s, err := dnstest.NewServer(zone, faults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	addr := s.Addr()
+	return DNSProvider{Name: name, IP: addr.Addr().String(), Port: int(addr.Port())}, s
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults dnstest.Faults
+		useTCP bool
+		check  func(t *testing.T, r TestResult)
+	}{
+		{name: "none", check: func(t *testing.T, r TestResult) {
+			if !r.Success || r.Loss != 0 {
+				t.Errorf("failed: %v", r.Errors)
+			}
+			for _, q := range r.Queries {
+				if q.Rcode != "NOERROR" || !reflect.DeepEqual(q.Addrs, []string{"192.0.2.1"}) || q.TTLs[0] != dnstest.TTL {
+					t.Errorf("unexpected query result %+v", q)
+				}
+			}
+		}},
+		{name: "delay", faults: dnstest.Faults{Delay: 40 * time.Millisecond, Jitter: 20 * time.Millisecond}, check: func(t *testing.T, r TestResult) {
+			if !r.Success || r.Min < 40*time.Millisecond {
+				t.Errorf("fastest answer took %v, errors %v", r.Min, r.Errors)
+			}
+		}},
+		{name: "drop all", faults: dnstest.Faults{DropRate: 1}, check: func(t *testing.T, r TestResult) {
+			if r.Success || r.Loss != 100 || r.TestsDone != r.TotalTests {
+				t.Errorf("success %v, loss %v%%, %d of %d done", r.Success, r.Loss, r.TestsDone, r.TotalTests)
+			}
+			if len(r.Errors) == 0 || !strings.Contains(r.Errors[0], "timeout") {
+				t.Errorf("errors = %q, want a timeout", r.Errors)
+			}
+		}},
+		{name: "drop some", faults: dnstest.Faults{DropRate: 0.5, Seed: 1}, check: func(t *testing.T, r TestResult) {
+			if !r.Success || r.Loss == 0 || r.Loss == 100 {
+				t.Errorf("success %v with %v%% loss", r.Success, r.Loss)
+			}
+		}},
+		{name: "servfail", faults: dnstest.Faults{ServFailRate: 1}, check: func(t *testing.T, r TestResult) {
+			if r.Success || !reflect.DeepEqual(r.Errors, []string{"server returned SERVFAIL"}) {
+				t.Errorf("success %v, errors %q", r.Success, r.Errors)
+			}
+		}},
+		{name: "refused", faults: dnstest.Faults{RefusedRate: 1}, check: func(t *testing.T, r TestResult) {
+			if r.Success || !reflect.DeepEqual(r.Errors, []string{"server returned REFUSED"}) {
+				t.Errorf("success %v, errors %q", r.Success, r.Errors)
+			}
+		}},
+		{name: "nxdomain", faults: dnstest.Faults{NXDomainRate: 1}, check: func(t *testing.T, r TestResult) {
+			if !r.Success {
+				t.Errorf("NXDOMAIN counted as failure: %v", r.Errors)
+			}
+			for _, q := range r.Queries {
+				if q.Rcode != "NXDOMAIN" || q.Answers != 0 {
+					t.Errorf("unexpected query result %+v", q)
+				}
+			}
+		}},
+		{name: "truncate", faults: dnstest.Faults{TruncateRate: 1}, check: func(t *testing.T, r TestResult) {
+			for _, q := range r.Queries {
+				if q.Flags != "qr tc rd ra" || q.Answers != 0 {
+					t.Errorf("unexpected query result %+v", q)
+				}
+			}
+		}},
+		{name: "truncate over tcp", faults: dnstest.Faults{TruncateRate: 1}, useTCP: true, check: func(t *testing.T, r TestResult) {
+			for _, q := range r.Queries {
+				if q.Flags != "qr rd ra" || q.Answers != 1 {
+					t.Errorf("unexpected query result %+v", q)
+				}
+			}
+		}},
+		{name: "wrong answer", faults: dnstest.Faults{WrongAnswerRate: 1}, check: func(t *testing.T, r TestResult) {
+			if len(r.Findings) != 2 || r.Findings[0].Kind != FindingWrongAnswer || !strings.Contains(r.Findings[0].Detail, "203.0.113.66") {
+				t.Errorf("findings = %v", r.Findings)
+			}
+		}},
+		{name: "mismatch", faults: dnstest.Faults{MismatchRate: 1}, check: func(t *testing.T, r TestResult) {
+			if r.Success || !reflect.DeepEqual(r.Errors, []string{"response does not match query"}) {
+				t.Errorf("success %v, errors %q", r.Success, r.Errors)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, server := newMockServer(t, tt.name, "example.com", tt.faults)
+			config := TestConfig{
+				TestsPerDomain: 4,
+				Timeout:        300 * time.Millisecond,
+				UseTCP:         tt.useTCP,
+				ParallelTests:  true,
+				Domains:        []string{"www.example.com", "cdn.example.com"},
+				ExpectedAnswers: map[string][]string{
+					"www.example.com": {"192.0.2.0/24"},
+					"cdn.example.com": {"192.0.2.0/24"},
+				},
+			}
+			r := TestProvider(context.Background(), provider, config, nil)
+			if server.Queries() != config.TotalTests() {
+				t.Errorf("server saw %d queries, want %d", server.Queries(), config.TotalTests())
+			}
+			tt.check(t, r)
+		})
+	}
+}
+
+func TestLargeUDPResponses(t *testing.T) {
+	provider, _ := newMockServer(t, "local", "example.com", dnstest.Faults{})
+	// A CNAME chain too long for 512 bytes but within the EDNS payload
+	// size.
+	domain := strings.Repeat(dnstest.AliasLabel+".", 38) + "www.example.com"
+	config := TestConfig{
+		TestsPerDomain: 1,
+		Timeout:        time.Second,
+		Domains:        []string{domain},
+	}
+	for _, edns := range []bool{false, true} {
+		config.ClientSubnet = ""
+		if edns {
+			config.ClientSubnet = "198.51.100.0/24"
+		}
+		r := TestProvider(context.Background(), provider, config, nil)
+		if len(r.Queries) != 1 {
+			t.Fatalf("edns=%v: %d queries recorded, errors %v", edns, len(r.Queries), r.Errors)
+		}
+		q := r.Queries[0]
+		wantFlags, wantAnswers := "qr tc rd ra", 0
+		if edns {
+			wantFlags, wantAnswers = "qr rd ra", 39
+		}
+		if q.Flags != wantFlags || q.Answers != wantAnswers {
+			t.Errorf("edns=%v: flags %q with %d answers, want %q with %d; error %q", edns, q.Flags, q.Answers, wantFlags, wantAnswers, q.Error)
+		}
+	}
+}
+
+// TestRunWithFaults benchmarks a mix of well-behaved and faulty providers
+// the way the CLI and GUI do and checks the ranking and findings.
+func TestRunWithFaults(t *testing.T) {
+	const zone = "example.com"
+	fast, _ := newMockServer(t, "fast", zone, dnstest.Faults{})
+	slow, _ := newMockServer(t, "slow", zone, dnstest.Faults{Delay: 50 * time.Millisecond, Jitter: 10 * time.Millisecond})
+	flaky, _ := newMockServer(t, "flaky", zone, dnstest.Faults{DropRate: 0.3, Seed: 2})
+	broken, _ := newMockServer(t, "broken", zone, dnstest.Faults{ServFailRate: 1})
+	// Answering every name, including ones outside the zone, makes the
+	// hijacker redirect NXDOMAIN as well.
+	hijacker, _ := newMockServer(t, "hijacker", "", dnstest.Faults{WrongAnswerRate: 1})
+	providers := []DNSProvider{broken, slow, flaky, hijacker, fast}
+	config := TestConfig{
+		TestsPerDomain: 3,
+		Timeout:        500 * time.Millisecond,
+		Domains:        []string{"www.example.com", "cdn.example.com"},
+		CheckAnswers:   true,
+	}
+
+	var calls int
+	results := Run(context.Background(), providers, config, func(QueryResult) { calls++ })
+	if calls != len(providers)*config.TotalTests() {
+		t.Errorf("callback ran %d times, want %d", calls, len(providers)*config.TotalTests())
+	}
+	byName := make(map[string]TestResult)
+	for _, r := range results {
+		byName[r.Provider.Name] = r
+		if r.TestsDone != config.TotalTests() {
+			t.Errorf("%s: %d of %d queries done", r.Provider.Name, r.TestsDone, r.TotalTests)
+		}
+	}
+
+	if r := byName["flaky"]; !r.Success || r.Loss == 0 {
+		t.Errorf("flaky: success %v with %v%% loss", r.Success, r.Loss)
+	}
+	if r := byName["broken"]; r.Success || r.Latency != config.Timeout {
+		t.Errorf("broken: success %v, latency %v", r.Success, r.Latency)
+	}
+	kinds := make(map[string]int)
+	for _, f := range byName["hijacker"].Findings {
+		kinds[f.Kind]++
+	}
+	if kinds[FindingWrongAnswer] != 2 || kinds[FindingNXDOMAINRedirect] != 1 {
+		t.Errorf("hijacker findings = %v", byName["hijacker"].Findings)
+	}
+	for _, name := range []string{"fast", "slow", "flaky", "broken"} {
+		if f := byName[name].Findings; len(f) != 0 {
+			t.Errorf("%s: unexpected findings %v", name, f)
+		}
+	}
+
+	SortByLatency(results)
+	rank := make(map[string]int)
+	for i, r := range results {
+		rank[r.Provider.Name] = i
+	}
+	if rank["fast"] > rank["slow"] || rank["broken"] != len(results)-1 {
+		t.Errorf("ranking fast %d, slow %d, broken %d of %d", rank["fast"], rank["slow"], rank["broken"], len(results))
+	}
+}
+
+func TestDomainTypes(t *testing.T) {
+	provider, _ := newMockServer(t, "local", "example.com", dnstest.Faults{ServFailTypes: []dnsmessage.Type{65}})
+	config := TestConfig{
+		TestsPerDomain: 2,
+		Timeout:        time.Second,
+		Domains:        []string{"example.com", "alias.alias.www.example.com"},
+		DomainTypes: map[string][]string{
+			"example.com":                 {"MX", "TXT", "NS", "SOA", "SRV", "SVCB", "HTTPS"},
+			"alias.alias.www.example.com": {"A", "CNAME"},
+		},
+	}
+	if n := config.TotalTests(); n != 18 {
+		t.Errorf("TotalTests = %d, want 18", n)
+	}
+	r := TestProvider(context.Background(), provider, config, nil)
+	if r.TestsDone != 18 || r.Loss != 200.0/18 {
+		t.Errorf("%d queries done with %v%% loss, errors %v", r.TestsDone, r.Loss, r.Errors)
+	}
+	var types []string
+	for qtype, s := range r.TypeStats {
+		types = append(types, qtype)
+		if want := 0.0; qtype == "HTTPS" {
+			if s.Loss != 100 {
+				t.Errorf("HTTPS: %v%% loss, want 100", s.Loss)
+			}
+		} else if s.Loss != want {
+			t.Errorf("%s: %v%% loss", qtype, s.Loss)
+		}
+	}
+	sort.Strings(types)
+	if want := []string{"A", "CNAME", "HTTPS", "MX", "NS", "SOA", "SRV", "SVCB", "TXT"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("TypeStats has %q, want %q", types, want)
+	}
+	for _, q := range r.Queries {
+		if q.Domain != "alias.alias.www.example.com" {
+			continue
+		}
+		wantCNAMEs, wantAddrs := []string{"alias.www.example.com", "www.example.com"}, []string{"192.0.2.1"}
+		if q.QueryType == "CNAME" {
+			wantCNAMEs, wantAddrs = wantCNAMEs[:1], nil
+		}
+		if !reflect.DeepEqual(q.CNAMEs, wantCNAMEs) || !reflect.DeepEqual(q.Addrs, wantAddrs) {
+			t.Errorf("%s query: CNAMEs %q, addresses %q", q.QueryType, q.CNAMEs, q.Addrs)
+		}
+	}
+}
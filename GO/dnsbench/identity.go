@@ -0,0 +1,115 @@
+package dnsbench
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// optionNSID is the EDNS option code of the name server identifier.
+const optionNSID = 3
+
+// ResolverIdentity is what a provider says about the server instance that
+// answered. For anycast services it usually names the site reached, so a
+// change between runs shows that queries went to a different place.
+type ResolverIdentity struct {
+	// NSID is the name server identifier (RFC 5001) returned with an
+	// answer, shown as hex when it is not printable text.
+	NSID string
+	// IDServer and HostnameBind are the TXT answers to the CHAOS-class
+	// queries for id.server (RFC 4892) and hostname.bind.
+	IDServer, HostnameBind string
+}
+
+// Instance is the most specific identifier the provider gave, or "" if it
+// gave none.
+func (r ResolverIdentity) Instance() string {
+	for _, id := range []string{r.NSID, r.IDServer, r.HostnameBind} {
+		if id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// String lists the identifiers that were returned, or says there were none.
+func (r ResolverIdentity) String() string {
+	var parts []string
+	for _, p := range []struct{ name, id string }{
+		{"NSID", r.NSID},
+		{"id.server", r.IDServer},
+		{"hostname.bind", r.HostnameBind},
+	} {
+		if p.id != "" {
+			parts = append(parts, p.name+" "+p.id)
+		}
+	}
+	if len(parts) == 0 {
+		return "not disclosed"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// probeIdentity asks the provider to identify itself: with an NSID option
+// on a query for the first test domain, and with the CHAOS queries.
+// Providers that refuse or ignore a question leave its field empty.
+func probeIdentity(ctx context.Context, c exchanger, provider DNSProvider, config TestConfig, transport Transport) *ResolverIdentity {
+	lookup := func(name string, qtype dnsmessage.Type, opts queryOptions) *dnsmessage.Message {
+		qctx, cancel := context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+		q := QueryResult{Provider: provider.Name, Domain: name, Transport: transport}
+		reply, err := lookupWith(qctx, c, name, qtype, opts, &q)
+		if err != nil {
+			return nil
+		}
+		return reply
+	}
+
+	var id ResolverIdentity
+	if reply := lookup(config.domains()[0], dnsmessage.TypeA, queryOptions{nsid: true}); reply != nil {
+		id.NSID = nsid(reply)
+	}
+	chaos := queryOptions{class: dnsmessage.ClassCHAOS}
+	if reply := lookup("id.server", dnsmessage.TypeTXT, chaos); reply != nil {
+		id.IDServer = txt(reply)
+	}
+	if reply := lookup("hostname.bind", dnsmessage.TypeTXT, chaos); reply != nil {
+		id.HostnameBind = txt(reply)
+	}
+	return &id
+}
+
+// nsid returns the NSID option of msg.
+func nsid(msg *dnsmessage.Message) string {
+	for _, rr := range msg.Additionals {
+		opt, ok := rr.Body.(*dnsmessage.OPTResource)
+		if !ok {
+			continue
+		}
+		for _, o := range opt.Options {
+			if o.Code != optionNSID || len(o.Data) == 0 {
+				continue
+			}
+			for _, b := range o.Data {
+				if b < ' ' || b > '~' {
+					return hex.EncodeToString(o.Data)
+				}
+			}
+			return string(o.Data)
+		}
+	}
+	return ""
+}
+
+// txt returns the text of the TXT records in the answer of msg.
+func txt(msg *dnsmessage.Message) string {
+	var parts []string
+	for _, rr := range msg.Answers {
+		if body, ok := rr.Body.(*dnsmessage.TXTResource); ok {
+			parts = append(parts, strings.Join(body.TXT, ""))
+		}
+	}
+	return strings.Join(parts, " ")
+}
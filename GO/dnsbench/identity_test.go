@@ -0,0 +1,50 @@
+package dnsbench
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench/dnstest"
+)
+
+func TestIdentifyResolver(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity string
+		want     ResolverIdentity
+		instance string
+		summary  string
+	}{
+		{"anycast site", "ams01.example.net", ResolverIdentity{NSID: "ams01.example.net", IDServer: "ams01.example.net", HostnameBind: "ams01.example.net"},
+			"ams01.example.net", "NSID ams01.example.net, id.server ams01.example.net, hostname.bind ams01.example.net"},
+		{"binary NSID", "\x01\xfe", ResolverIdentity{NSID: "01fe", IDServer: "\x01\xfe", HostnameBind: "\x01\xfe"}, "01fe", ""},
+		{"anonymous", "", ResolverIdentity{}, "", "not disclosed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, s := newMockServer(t, tt.name, "example.com", dnstest.Faults{})
+			s.SetIdentity(tt.identity)
+			config := TestConfig{
+				Domains:          []string{"www.example.com"},
+				TestsPerDomain:   1,
+				Timeout:          time.Second,
+				IdentifyResolver: true,
+			}
+			r := TestProvider(context.Background(), provider, config, nil)
+			if !r.Success || r.Identity == nil {
+				t.Fatalf("success %v, identity %v, errors %v", r.Success, r.Identity, r.Errors)
+			}
+			if *r.Identity != tt.want || r.Identity.Instance() != tt.instance {
+				t.Errorf("identity %+v, instance %q; want %+v, %q", *r.Identity, r.Identity.Instance(), tt.want, tt.instance)
+			}
+			if tt.summary != "" && r.Identity.String() != tt.summary {
+				t.Errorf("String() = %q, want %q", r.Identity, tt.summary)
+			}
+			// The probes are not part of the measurements.
+			if r.TestsDone != 1 || len(r.Queries) != 1 {
+				t.Errorf("%d queries recorded", len(r.Queries))
+			}
+		})
+	}
+}
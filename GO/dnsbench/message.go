@@ -0,0 +1,226 @@
+package dnsbench
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// queryOptions are the optional parts of a query. Setting any but class
+// adds an EDNS(0) OPT record.
+type queryOptions struct {
+	// class is the class of the question, ClassINET if zero.
+	class dnsmessage.Class
+	// dnssecOK sets the DO bit, asking for RRSIG records.
+	dnssecOK bool
+	// clientSubnet is sent as an EDNS Client Subnet option if valid.
+	clientSubnet netip.Prefix
+	// nsid asks for the server's identifier (RFC 5001).
+	nsid bool
+}
+
+func (o queryOptions) edns() bool {
+	return o.dnssecOK || o.clientSubnet.IsValid() || o.nsid
+}
+
+// ednsPayload is the UDP payload size advertised with EDNS(0), the value
+// recommended by DNS Flag Day 2020.
+const ednsPayload = 1232
+
+// newQuery builds a recursive wire-format query for a single question.
+func newQuery(id uint16, domain string, qtype dnsmessage.Type, opts queryOptions) ([]byte, error) {
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+	name, err := dnsmessage.NewName(domain)
+	if err != nil {
+		return nil, err
+	}
+	class := opts.class
+	if class == 0 {
+		class = dnsmessage.ClassINET
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: qtype, Class: class},
+		},
+	}
+	if opts.edns() {
+		var hdr dnsmessage.ResourceHeader
+		if err := hdr.SetEDNS0(ednsPayload, dnsmessage.RCodeSuccess, opts.dnssecOK); err != nil {
+			return nil, err
+		}
+		opt := &dnsmessage.OPTResource{}
+		if opts.clientSubnet.IsValid() {
+			opt.Options = append(opt.Options, ecsOption(opts.clientSubnet))
+		}
+		if opts.nsid {
+			opt.Options = append(opt.Options, dnsmessage.Option{Code: optionNSID})
+		}
+		msg.Additionals = []dnsmessage.Resource{{Header: hdr, Body: opt}}
+	}
+	return msg.Pack()
+}
+
+// parseResponse unpacks a response and checks that it answers query.
+func parseResponse(id uint16, query, b []byte) (*dnsmessage.Message, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(b); err != nil {
+		return nil, fmt.Errorf("malformed response: %v", err)
+	}
+	var sent dnsmessage.Message
+	if err := sent.Unpack(query); err != nil {
+		return nil, err
+	}
+	if !msg.Response || msg.ID != id || len(msg.Questions) != 1 ||
+		!strings.EqualFold(msg.Questions[0].Name.String(), sent.Questions[0].Name.String()) ||
+		msg.Questions[0].Type != sent.Questions[0].Type {
+		return nil, fmt.Errorf("response does not match query")
+	}
+	return &msg, nil
+}
+
+// recordResponse copies the interesting parts of a response into q.
+func recordResponse(q *QueryResult, msg *dnsmessage.Message, size int) {
+	q.Rcode = rcodeName(msg.RCode)
+	q.Flags = flagString(msg.Header)
+	q.Answers = len(msg.Answers)
+	q.Size = size
+	q.TTLs = nil
+	q.Addrs = nil
+	q.CNAMEs = nil
+	q.ECSScope, q.ECSEchoed = ecsScope(msg)
+	for _, rr := range msg.Answers {
+		q.TTLs = append(q.TTLs, rr.Header.TTL)
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			q.Addrs = append(q.Addrs, netip.AddrFrom4(body.A).String())
+		case *dnsmessage.AAAAResource:
+			q.Addrs = append(q.Addrs, netip.AddrFrom16(body.AAAA).String())
+		case *dnsmessage.CNAMEResource:
+			q.CNAMEs = append(q.CNAMEs, strings.TrimSuffix(body.CNAME.String(), "."))
+		}
+	}
+}
+
+// flagString lists the header flags that are set, in dig's notation.
+func flagString(h dnsmessage.Header) string {
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{h.Response, "qr"},
+		{h.Authoritative, "aa"},
+		{h.Truncated, "tc"},
+		{h.RecursionDesired, "rd"},
+		{h.RecursionAvailable, "ra"},
+		{h.AuthenticData, "ad"},
+		{h.CheckingDisabled, "cd"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// Record types dnsmessage has no constant for (RFC 4034 and RFC 9460).
+const (
+	typeRRSIG dnsmessage.Type = 46
+	typeSVCB  dnsmessage.Type = 64
+	typeHTTPS dnsmessage.Type = 65
+)
+
+var typeNames = map[dnsmessage.Type]string{
+	dnsmessage.TypeA:     "A",
+	dnsmessage.TypeNS:    "NS",
+	dnsmessage.TypeCNAME: "CNAME",
+	dnsmessage.TypeSOA:   "SOA",
+	dnsmessage.TypePTR:   "PTR",
+	dnsmessage.TypeMX:    "MX",
+	dnsmessage.TypeTXT:   "TXT",
+	dnsmessage.TypeAAAA:  "AAAA",
+	dnsmessage.TypeSRV:   "SRV",
+	typeSVCB:             "SVCB",
+	typeHTTPS:            "HTTPS",
+}
+
+// QueryTypes are the record types offered for testing, in the order
+// results list them.
+var QueryTypes = []string{"A", "AAAA", "CNAME", "MX", "TXT", "NS", "SOA", "SRV", "HTTPS", "SVCB"}
+
+// ValidQueryType reports whether name is a record type that can be
+// queried, ignoring case.
+func ValidQueryType(name string) bool {
+	_, err := parseType(name)
+	return err == nil
+}
+
+// parseType maps a record type name such as "AAAA" to its code. The empty
+// string means A.
+func parseType(name string) (dnsmessage.Type, error) {
+	if name == "" {
+		return dnsmessage.TypeA, nil
+	}
+	for t, n := range typeNames {
+		if strings.EqualFold(n, name) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown query type %q", name)
+}
+
+func typeName(t dnsmessage.Type) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+func rcodeName(rcode dnsmessage.RCode) string {
+	switch rcode {
+	case dnsmessage.RCodeSuccess:
+		return "NOERROR"
+	case dnsmessage.RCodeFormatError:
+		return "FORMERR"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeNotImplemented:
+		return "NOTIMP"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	default:
+		return fmt.Sprintf("RCODE%d", rcode)
+	}
+}
+
+// writeStreamMsg writes msg with the two-byte length prefix used by DNS over
+// stream transports.
+func writeStreamMsg(w io.Writer, msg []byte) error {
+	b := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(b, uint16(len(msg)))
+	copy(b[2:], msg)
+	_, err := w.Write(b)
+	return err
+}
+
+// readStreamMsg reads one length-prefixed message.
+func readStreamMsg(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
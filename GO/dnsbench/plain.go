@@ -0,0 +1,64 @@
+package dnsbench
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// plainClient sends queries to port 53 over UDP, or over a new TCP
+// connection per query, without the retries and search-domain handling of
+// net.Resolver.
+type plainClient struct {
+	addr    string
+	network string
+	timeout time.Duration
+}
+
+func newPlainClient(provider DNSProvider, config TestConfig, transport Transport) *plainClient {
+	return &plainClient{
+		addr:    config.serverAddr(provider, transport),
+		network: string(transport),
+		timeout: config.Timeout,
+	}
+}
+
+func (c *plainClient) exchange(ctx context.Context, msg []byte, q *QueryResult) ([]byte, error) {
+	d := net.Dialer{Timeout: c.timeout}
+	conn, err := d.DialContext(ctx, c.network, c.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Unblock the read as soon as ctx is cancelled, not only at its deadline.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if c.network == "tcp" {
+		if err := writeStreamMsg(conn, msg); err != nil {
+			return nil, err
+		}
+		return readStreamMsg(conn)
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Skip stray datagrams that cannot be the reply to this query.
+		if n >= 2 && binary.BigEndian.Uint16(buf) == binary.BigEndian.Uint16(msg) {
+			return buf[:n], nil
+		}
+	}
+}
+
+func (c *plainClient) close() {}
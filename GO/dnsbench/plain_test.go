@@ -0,0 +1,101 @@
+package dnsbench
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench/dnstest"
+)
+
+// newPlainServer starts a dnstest server for every name and returns a
+// provider and config pointing at it.
+func newPlainServer(t *testing.T, faults dnstest.Faults) (DNSProvider, TestConfig, *dnstest.Server) {
+	t.Helper()
+	provider, s := newMockServer(t, "local", "", faults)
+	config := TestConfig{
+		TestsPerDomain: 2,
+		Timeout:        2 * time.Second,
+		Domains:        []string{"example.com", "example.net"},
+	}
+	return provider, config, s
+}
+
+func TestPlainOneQuestionPerQuery(t *testing.T) {
+	for _, useTCP := range []bool{false, true} {
+		provider, config, s := newPlainServer(t, dnstest.Faults{})
+		config.UseTCP = useTCP
+		config.QueryType = "aaaa"
+
+		result := TestProvider(context.Background(), provider, config, nil)
+		if !result.Success || len(result.Errors) != 0 {
+			t.Fatalf("tcp=%v: run failed: %v", useTCP, result.Errors)
+		}
+		if n := s.Queries(); n != config.TotalTests() {
+			t.Errorf("tcp=%v: server saw %d queries, want %d", useTCP, n, config.TotalTests())
+		}
+		want := TransportUDP
+		if useTCP {
+			want = TransportTCP
+		}
+		for _, q := range result.Queries {
+			if q.Transport != want || q.QueryType != "AAAA" || q.Rcode != "NOERROR" ||
+				q.Flags != "qr rd ra" || q.Answers != 1 || len(q.TTLs) != 1 || q.TTLs[0] != 60 || q.Size == 0 {
+				t.Errorf("tcp=%v: unexpected query result %+v", useTCP, q)
+			}
+		}
+	}
+}
+
+func TestPlainRcodes(t *testing.T) {
+	tests := []struct {
+		faults  dnstest.Faults
+		name    string
+		success bool
+	}{
+		{dnstest.Faults{NXDomainRate: 1}, "NXDOMAIN", true},
+		{dnstest.Faults{ServFailRate: 1}, "SERVFAIL", false},
+		{dnstest.Faults{RefusedRate: 1}, "REFUSED", false},
+	}
+	for _, tt := range tests {
+		provider, config, _ := newPlainServer(t, tt.faults)
+		result := TestProvider(context.Background(), provider, config, nil)
+		if result.Success != tt.success {
+			t.Errorf("%s: success = %v, want %v", tt.name, result.Success, tt.success)
+		}
+		for _, q := range result.Queries {
+			if q.Rcode != tt.name {
+				t.Errorf("%s: recorded rcode %q", tt.name, q.Rcode)
+			}
+		}
+		if !tt.success && (len(result.Errors) != 1 || !strings.Contains(result.Errors[0], tt.name)) {
+			t.Errorf("%s: errors = %q", tt.name, result.Errors)
+		}
+	}
+}
+
+func TestUnknownQueryType(t *testing.T) {
+	provider, config, s := newPlainServer(t, dnstest.Faults{})
+	config.QueryType = "BOGUS"
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if result.Success || s.Queries() != 0 {
+		t.Errorf("run with an unknown query type reached the server")
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	provider, config, s := newPlainServer(t, dnstest.Faults{Delay: 20 * time.Millisecond})
+	config.TestsPerDomain = 4
+	config.ParallelTests = true
+	config.Concurrency = 2
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if !result.Success || len(result.Queries) != 8 {
+		t.Fatalf("run failed: %v", result.Errors)
+	}
+	if peak := s.PeakInFlight(); peak != 2 {
+		t.Errorf("peak of %d queries in flight, want 2", peak)
+	}
+}
@@ -0,0 +1,384 @@
+package dnsbench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Run benchmarks all providers concurrently and returns one TestResult per
+// provider, in the same order as providers.
+//
+// onQuery, if non-nil, is called after every query. Calls are serialised, so
+// the callback does not need its own locking.
+//
+// Cancelling ctx stops the run: queries in flight are abandoned, no more are
+// sent, and the partial results are returned with Cancelled set. A run can
+// be paused through a context from WithPause.
+func Run(ctx context.Context, providers []DNSProvider, config TestConfig, onQuery func(QueryResult)) []TestResult {
+	var mu sync.Mutex
+	report := func(q QueryResult) {
+		if onQuery == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		onQuery(q)
+	}
+
+	results := make([]TestResult, len(providers))
+	timeStamp := time.Now()
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, p DNSProvider) {
+			defer wg.Done()
+			results[i] = TestProvider(ctx, p, config, report)
+			results[i].TimeStamp = timeStamp
+		}(i, provider)
+	}
+	wg.Wait()
+	if config.CheckAnswers {
+		checkConsensus(results, config.ExpectedAnswers)
+	}
+	return results
+}
+
+// TestProvider runs config.TestsPerDomain queries for every test domain
+// against a single provider. With config.ParallelTests the queries are sent
+// concurrently, but as with Run calls to onQuery are serialised.
+func TestProvider(ctx context.Context, provider DNSProvider, config TestConfig, onQuery func(QueryResult)) TestResult {
+	transport := config.transport(provider)
+	var client exchanger
+	switch transport {
+	case TransportDoH:
+		client = newDoHClient(provider, config)
+	case TransportDoT:
+		client = newDoTClient(provider, config)
+	case TransportDoQ:
+		client = newDoQClient(provider, config)
+	default:
+		client = newPlainClient(provider, config, transport)
+	}
+	defer client.close()
+	jobs := config.plan()
+	var opts queryOptions
+	var subnetErr error
+	if config.ClientSubnet != "" {
+		opts.clientSubnet, subnetErr = ParseSubnet(config.ClientSubnet)
+	}
+
+	queries := make([]QueryResult, 0, config.TotalTests())
+	var mu sync.Mutex
+
+	runTest := func(j job) {
+		waitIfPaused(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		qctx, cancel := context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+
+		qtype, err := parseType(j.qtype)
+		q := QueryResult{
+			Provider:  provider.Name,
+			Domain:    j.name,
+			QueryType: j.qtype,
+			Transport: transport,
+			Uncached:  j.uncached,
+			TimeStamp: time.Now(),
+		}
+		if err == nil {
+			q.QueryType = typeName(qtype)
+			err = subnetErr
+		}
+		if err == nil {
+			_, err = lookupWith(qctx, client, j.name, qtype, opts, &q)
+		}
+		q.Latency = time.Since(q.TimeStamp)
+		if err != nil && ctx.Err() != nil {
+			// Stopped by the caller, not a failure of the provider.
+			return
+		}
+		switch {
+		case err != nil:
+			q.Error = err.Error()
+		case q.Latency >= config.Timeout:
+			q.Error = "timeout"
+		default:
+			q.Success = true
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, q)
+		if onQuery != nil {
+			onQuery(q)
+		}
+	}
+
+	if config.ParallelTests {
+		limit := config.Concurrency
+		if limit <= 0 || limit > len(jobs) {
+			limit = len(jobs)
+		}
+		sem := make(chan struct{}, limit)
+		var wg sync.WaitGroup
+		for _, j := range jobs {
+			if ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(j job) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				runTest(j)
+			}(j)
+		}
+		wg.Wait()
+	} else {
+		for _, j := range jobs {
+			runTest(j)
+		}
+	}
+
+	result := summarize(provider, config, queries)
+	result.Cancelled = ctx.Err() != nil
+	checkExpected(&result, config.ExpectedAnswers)
+	if config.CheckAnswers && !result.Cancelled {
+		qctx, cancel := context.WithTimeout(ctx, config.Timeout)
+		if f := probeNXDOMAIN(qctx, client, provider, transport); f != nil {
+			result.Findings = append(result.Findings, *f)
+		}
+		cancel()
+	}
+	if config.CheckDNSSEC && !result.Cancelled {
+		result.DNSSEC = probeDNSSEC(ctx, client, provider, config, transport)
+	}
+	if config.IdentifyResolver && !result.Cancelled {
+		result.Identity = probeIdentity(ctx, client, provider, config, transport)
+	}
+	return result
+}
+
+type pauseKey struct{}
+
+// WithPause returns a context under which Run and TestProvider call wait
+// before sending each query, so that a caller can pause a run by having
+// wait block. wait should return once ctx is cancelled.
+func WithPause(ctx context.Context, wait func(ctx context.Context)) context.Context {
+	return context.WithValue(ctx, pauseKey{}, wait)
+}
+
+func waitIfPaused(ctx context.Context) {
+	if wait, ok := ctx.Value(pauseKey{}).(func(context.Context)); ok {
+		wait(ctx)
+	}
+}
+
+// job is one query of a run.
+type job struct {
+	name     string
+	qtype    string
+	uncached bool
+}
+
+// plan lists the queries to send to a provider. With UncachedTests every
+// cacheable query is paired with one for a fresh random name, so the two
+// kinds are spread evenly over the run.
+func (c TestConfig) plan() []job {
+	var jobs []job
+	for _, domain := range c.domains() {
+		for i := 0; i < c.TestsPerDomain; i++ {
+			for _, qtype := range c.Types(domain) {
+				jobs = append(jobs, job{name: domain, qtype: qtype})
+				if c.UncachedTests {
+					jobs = append(jobs, job{name: c.uncachedName(domain), qtype: qtype, uncached: true})
+				}
+			}
+		}
+	}
+	return jobs
+}
+
+// uncachedName returns a name no resolver can have cached: a random label
+// under UncachedZone, or under domain itself when no zone is configured.
+func (c TestConfig) uncachedName(domain string) string {
+	zone := strings.TrimSuffix(c.UncachedZone, ".")
+	if zone == "" {
+		zone = domain
+	}
+	return randomName(zone)
+}
+
+// randomName prepends a random 16-character label to zone.
+func randomName(zone string) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	label := make([]byte, 16)
+	for i := range label {
+		label[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(label) + "." + zone
+}
+
+// exchanger sends one wire-format message and records transport-specific
+// timings in q.
+type exchanger interface {
+	exchange(ctx context.Context, msg []byte, q *QueryResult) ([]byte, error)
+	close()
+}
+
+// lookup sends exactly one question and records what came back. NXDOMAIN
+// counts as an answer; other error rcodes fail the query.
+func lookup(ctx context.Context, c exchanger, domain string, qtype dnsmessage.Type, q *QueryResult) error {
+	_, err := lookupWith(ctx, c, domain, qtype, queryOptions{}, q)
+	return err
+}
+
+// lookupWith is lookup with query options. It also returns the response,
+// which is set even when an error rcode fails the query.
+func lookupWith(ctx context.Context, c exchanger, domain string, qtype dnsmessage.Type, opts queryOptions, q *QueryResult) (*dnsmessage.Message, error) {
+	// RFC 8484 recommends ID 0 for DoH so that responses are cacheable, and
+	// RFC 9250 requires it for DoQ.
+	var id uint16
+	if q.Transport != TransportDoH && q.Transport != TransportDoQ {
+		id = uint16(rand.Uint32())
+	}
+	msg, err := newQuery(id, domain, qtype, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.exchange(ctx, msg, q)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := parseResponse(id, msg, resp)
+	if err != nil {
+		return nil, err
+	}
+	recordResponse(q, reply, len(resp))
+	if reply.RCode != dnsmessage.RCodeSuccess && reply.RCode != dnsmessage.RCodeNameError {
+		return reply, fmt.Errorf("server returned %s", q.Rcode)
+	}
+	return reply, nil
+}
+
+func summarize(provider DNSProvider, config TestConfig, queries []QueryResult) TestResult {
+	result := TestResult{
+		Provider:   provider,
+		TestsDone:  len(queries),
+		TotalTests: config.TotalTests(),
+		TimeStamp:  time.Now(),
+		Queries:    queries,
+	}
+
+	var cached, uncached []QueryResult
+	for _, q := range queries {
+		if q.Uncached {
+			uncached = append(uncached, q)
+		} else {
+			cached = append(cached, q)
+		}
+	}
+	result.Stats = computeStats(cached)
+	if config.ClientSubnet != "" {
+		result.ECS = summarizeECS(queries)
+	}
+	byType := make(map[string][]QueryResult)
+	for _, q := range cached {
+		byType[q.QueryType] = append(byType[q.QueryType], q)
+	}
+	if len(byType) > 1 {
+		result.TypeStats = make(map[string]Stats)
+		for t, qs := range byType {
+			result.TypeStats[t] = computeStats(qs)
+		}
+	}
+	if len(uncached) > 0 {
+		result.UncachedStats = computeStats(uncached)
+		result.UncachedLatency = meanLatency(uncached)
+	}
+
+	var totalLatency, firstLatency, reusedLatency, handshakeLatency time.Duration
+	var zeroRTTLatency, oneRTTLatency time.Duration
+	var successfulTests, firstQueries, reusedQueries, zeroRTTQueries, oneRTTQueries int
+	seen := make(map[string]bool)
+	for _, q := range queries {
+		if q.Success {
+			if !q.Uncached {
+				totalLatency += q.Latency
+				successfulTests++
+			}
+			if q.Reused {
+				reusedLatency += q.Latency
+				reusedQueries++
+			} else if q.Handshake > 0 {
+				firstLatency += q.Latency
+				handshakeLatency += q.Handshake
+				firstQueries++
+				if q.Transport == TransportDoQ {
+					if q.ZeroRTT {
+						zeroRTTLatency += q.Latency
+						zeroRTTQueries++
+					} else {
+						oneRTTLatency += q.Latency
+						oneRTTQueries++
+					}
+				}
+			}
+		} else if !seen[q.Error] {
+			seen[q.Error] = true
+			result.Errors = append(result.Errors, q.Error)
+		}
+	}
+
+	if successfulTests == 0 {
+		result.Latency = config.Timeout
+		return result
+	}
+	result.Latency = totalLatency / time.Duration(successfulTests)
+	result.Success = true
+	if firstQueries > 0 {
+		result.FirstQueryLatency = firstLatency / time.Duration(firstQueries)
+		result.HandshakeLatency = handshakeLatency / time.Duration(firstQueries)
+	}
+	if zeroRTTQueries > 0 {
+		result.ZeroRTTLatency = zeroRTTLatency / time.Duration(zeroRTTQueries)
+	}
+	if oneRTTQueries > 0 {
+		result.OneRTTLatency = oneRTTLatency / time.Duration(oneRTTQueries)
+	}
+	if reusedQueries > 0 {
+		result.ReusedLatency = reusedLatency / time.Duration(reusedQueries)
+	}
+	return result
+}
+
+func meanLatency(queries []QueryResult) time.Duration {
+	var total time.Duration
+	var n int
+	for _, q := range queries {
+		if q.Success {
+			total += q.Latency
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / time.Duration(n)
+}
+
+// SortByLatency orders results fastest first.
+func SortByLatency(results []TestResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Latency < results[j].Latency
+	})
+}
@@ -0,0 +1,105 @@
+package dnsbench
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench/dnstest"
+)
+
+func TestCancelRun(t *testing.T) {
+	config := TestConfig{
+		TestsPerDomain: 1,
+		Timeout:        5 * time.Second,
+		Domains:        []string{"a.bench.test", "b.bench.test", "c.bench.test"},
+	}
+	for _, parallel := range []bool{false, true} {
+		// No query is answered in time.
+		provider, _ := newMockServer(t, "slow", "", dnstest.Faults{Delay: 10 * time.Second})
+		config.ParallelTests = parallel
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		start := time.Now()
+		results := Run(ctx, []DNSProvider{provider}, config, nil)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("parallel=%v: run took %v after being cancelled", parallel, elapsed)
+		}
+		r := results[0]
+		if !r.Cancelled {
+			t.Errorf("parallel=%v: result not marked cancelled", parallel)
+		}
+		if r.TestsDone != 0 || len(r.Errors) != 0 {
+			t.Errorf("parallel=%v: abandoned queries recorded as %d done, errors %v", parallel, r.TestsDone, r.Errors)
+		}
+	}
+}
+
+func TestPauseHoldsBackQueries(t *testing.T) {
+	provider, config, s := newPlainServer(t, dnstest.Faults{})
+	config.ParallelTests = true
+	resumed := make(chan struct{})
+	ctx := WithPause(context.Background(), func(ctx context.Context) {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+		}
+	})
+
+	done := make(chan TestResult)
+	go func() { done <- TestProvider(ctx, provider, config, nil) }()
+	time.Sleep(100 * time.Millisecond)
+	if n := s.Queries(); n != 0 {
+		t.Errorf("%d queries sent while paused", n)
+	}
+	close(resumed)
+	if r := <-done; r.TestsDone != config.TotalTests() {
+		t.Errorf("%d of %d queries done after resuming", r.TestsDone, config.TotalTests())
+	}
+}
+
+// TestParallelRunIsRaceFree is meant for go test -race: callbacks and
+// summaries must not touch shared state concurrently when every provider
+// and every query runs at once.
+func TestParallelRunIsRaceFree(t *testing.T) {
+	var providers []DNSProvider
+	for i := 0; i < 4; i++ {
+		p, _, _ := newPlainServer(t, dnstest.Faults{})
+		p.Name = fmt.Sprintf("stub %d", i)
+		providers = append(providers, p)
+	}
+	config := TestConfig{
+		TestsPerDomain: 5,
+		Timeout:        2 * time.Second,
+		ParallelTests:  true,
+		UncachedTests:  true,
+		Domains:        []string{"a.example", "b.example", "c.example"},
+	}
+
+	// No locking: Run promises serialised callbacks.
+	perProvider := make(map[string]int)
+	var last time.Time
+	results := Run(context.Background(), providers, config, func(q QueryResult) {
+		perProvider[q.Provider]++
+		last = q.TimeStamp
+	})
+	if last.IsZero() {
+		t.Error("callback never ran")
+	}
+	for _, r := range results {
+		if !r.Success || r.TestsDone != config.TotalTests() {
+			t.Errorf("%s: %d of %d queries done, errors %v", r.Provider.Name, r.TestsDone, config.TotalTests(), r.Errors)
+		}
+		if perProvider[r.Provider.Name] != r.TestsDone {
+			t.Errorf("%s: callback saw %d queries, result has %d", r.Provider.Name, perProvider[r.Provider.Name], r.TestsDone)
+		}
+	}
+
+	var calls int
+	TestProvider(context.Background(), providers[0], config, func(QueryResult) { calls++ })
+	if calls != config.TotalTests() {
+		t.Errorf("TestProvider callback ran %d times, want %d", calls, config.TotalTests())
+	}
+}
@@ -0,0 +1,82 @@
+package dnsbench
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Stats describes the latency distribution of a provider's successful
+// queries and how many queries failed.
+type Stats struct {
+	Min    time.Duration
+	Max    time.Duration
+	Median time.Duration
+	P90    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	StdDev time.Duration
+	// Jitter is the mean absolute difference between the latencies of
+	// consecutive queries, in the order they were sent.
+	Jitter time.Duration
+	// Loss is the percentage of queries that did not get a usable answer.
+	Loss float64
+}
+
+func computeStats(queries []QueryResult) Stats {
+	var stats Stats
+	if len(queries) == 0 {
+		return stats
+	}
+
+	var ok []QueryResult
+	for _, q := range queries {
+		if q.Success {
+			ok = append(ok, q)
+		}
+	}
+	stats.Loss = 100 * float64(len(queries)-len(ok)) / float64(len(queries))
+	if len(ok) == 0 {
+		return stats
+	}
+
+	sort.SliceStable(ok, func(i, j int) bool { return ok[i].TimeStamp.Before(ok[j].TimeStamp) })
+	var jitter, sum float64
+	for i, q := range ok {
+		sum += float64(q.Latency)
+		if i > 0 {
+			jitter += math.Abs(float64(q.Latency - ok[i-1].Latency))
+		}
+	}
+	if len(ok) > 1 {
+		stats.Jitter = time.Duration(jitter / float64(len(ok)-1))
+	}
+
+	mean := sum / float64(len(ok))
+	var variance float64
+	latencies := make([]time.Duration, len(ok))
+	for i, q := range ok {
+		latencies[i] = q.Latency
+		d := float64(q.Latency) - mean
+		variance += d * d
+	}
+	stats.StdDev = time.Duration(math.Sqrt(variance / float64(len(ok))))
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.Min = latencies[0]
+	stats.Max = latencies[len(latencies)-1]
+	stats.Median = percentile(latencies, 50)
+	stats.P90 = percentile(latencies, 90)
+	stats.P95 = percentile(latencies, 95)
+	stats.P99 = percentile(latencies, 99)
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,46 @@
+package dnsbench
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeStats(t *testing.T) {
+	start := time.Now()
+	var queries []QueryResult
+	// 1ms..10ms sent in order, plus two failures.
+	for i := 1; i <= 10; i++ {
+		queries = append(queries, QueryResult{
+			TimeStamp: start.Add(time.Duration(i) * time.Second),
+			Latency:   time.Duration(i) * time.Millisecond,
+			Success:   true,
+		})
+	}
+	queries = append(queries,
+		QueryResult{TimeStamp: start, Latency: 3 * time.Second, Error: "timeout"},
+		QueryResult{TimeStamp: start, Latency: time.Millisecond, Error: "server returned SERVFAIL"},
+	)
+
+	stats := computeStats(queries)
+	want := Stats{
+		Min:    time.Millisecond,
+		Max:    10 * time.Millisecond,
+		Median: 5 * time.Millisecond,
+		P90:    9 * time.Millisecond,
+		P95:    10 * time.Millisecond,
+		P99:    10 * time.Millisecond,
+		StdDev: 2872281 * time.Nanosecond,
+		Jitter: time.Millisecond,
+		Loss:   100 * 2.0 / 12.0,
+	}
+	if stats != want {
+		t.Errorf("computeStats =\n%+v\nwant\n%+v", stats, want)
+	}
+}
+
+func TestComputeStatsAllFailed(t *testing.T) {
+	stats := computeStats([]QueryResult{{Error: "timeout"}, {Error: "timeout"}})
+	if stats != (Stats{Loss: 100}) {
+		t.Errorf("computeStats = %+v, want only 100%% loss", stats)
+	}
+}
@@ -0,0 +1,64 @@
+package dnsbench
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench/dnstest"
+)
+
+func TestUncachedQueries(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	config := TestConfig{
+		TestsPerDomain: 3,
+		Timeout:        2 * time.Second,
+		Domains:        []string{"www.bench.test", "mail.bench.test"},
+		UncachedTests:  true,
+		UncachedZone:   "bench.test.",
+	}
+	provider, s := newMockServer(t, "caching", "bench.test", dnstest.Faults{})
+	// Only the regular domains are in the cache.
+	s.SetCaching(delay, config.Domains...)
+
+	result := TestProvider(context.Background(), provider, config, nil)
+	if !result.Success || len(result.Errors) != 0 {
+		t.Fatalf("run failed: %v", result.Errors)
+	}
+	if len(result.Queries) != 12 || result.TotalTests != 12 {
+		t.Fatalf("got %d of %d queries, want 12", len(result.Queries), result.TotalTests)
+	}
+
+	names := make(map[string]bool)
+	for _, q := range result.Queries {
+		if !q.Uncached {
+			continue
+		}
+		if names[q.Domain] {
+			t.Errorf("uncached name %s queried twice", q.Domain)
+		}
+		names[q.Domain] = true
+		if !strings.HasSuffix(q.Domain, ".bench.test") {
+			t.Errorf("uncached name %s outside the configured zone", q.Domain)
+		}
+	}
+	if len(names) != 6 {
+		t.Errorf("got %d uncached queries, want 6", len(names))
+	}
+
+	if result.UncachedLatency < delay || result.UncachedStats.Min < delay {
+		t.Errorf("uncached latency %v (min %v) did not include resolution time", result.UncachedLatency, result.UncachedStats.Min)
+	}
+	if result.Latency >= delay || result.Max >= delay {
+		t.Errorf("cached latency %v (max %v) includes uncached queries", result.Latency, result.Max)
+	}
+}
+
+func TestUncachedNameDefaultsToDomain(t *testing.T) {
+	config := TestConfig{}
+	name := config.uncachedName("www.example.com")
+	if !strings.HasSuffix(name, ".www.example.com") || name == config.uncachedName("www.example.com") {
+		t.Errorf("uncachedName = %q, want a fresh label under www.example.com", name)
+	}
+}
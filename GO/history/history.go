@@ -0,0 +1,383 @@
+// Package history keeps past benchmark runs in a file of their own next to
+// settings.json.
+//
+// The file starts with a header line giving its schema version, followed
+// by one JSON-encoded dnsbench.Report per line. New runs are appended, so
+// adding a run never rewrites the others; pruning rewrites the whole file
+// atomically. The GUI, the CLI and serve mode may share the file, so every
+// write is made holding a lock file next to it, and a rewrite starts from
+// the file as it is on disk rather than from a Store's copy. A line left
+// incomplete by a crash is dropped when the file is next opened.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/internal/atomicfile"
+	"dns_speed_test/settings"
+)
+
+// SchemaVersion is the version of the file format this package writes.
+// Files of a newer version are refused rather than misread.
+const SchemaVersion = 1
+
+// header is the first line of the file.
+type header struct {
+	Schema int
+}
+
+// Store is the history file and an in-memory copy of the runs in it,
+// oldest first. It is safe for concurrent use.
+type Store struct {
+	path string
+
+	mu   sync.Mutex
+	runs []dnsbench.Report
+}
+
+// Path is the location of the history file in the user's config directory.
+func Path() (string, error) {
+	path, err := settings.Path()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "history.jsonl"), nil
+}
+
+// Load opens the history file at Path and moves the runs that s still
+// holds from older versions into it. s is saved without them once they are
+// safely in the store.
+func Load(s *settings.Settings) (*Store, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	store, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.History) > 0 {
+		if err := store.Import(s.History); err != nil {
+			return store, err
+		}
+		s.History = nil
+		if err := s.Save(); err != nil {
+			return store, err
+		}
+	}
+	return store, nil
+}
+
+// Open reads the history file at path. A missing file is an empty history;
+// it is created when the first run is added.
+func Open(path string) (*Store, error) {
+	runs, torn, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{path: path, runs: runs}
+	if torn {
+		// The line may be another process's append that is still being
+		// written; it is only dropped if it is still there once the lock
+		// is held.
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.update(func(runs []dnsbench.Report) ([]dnsbench.Report, bool) { return runs, false }); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// readFile returns the runs in the history file at path, oldest first, and
+// whether it ends in an incomplete line, which is left out.
+func readFile(path string) (runs []dnsbench.Report, torn bool, err error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Every complete line ends in a newline; anything after the
+			// last one is an append that did not finish.
+			torn = len(bytes.TrimSpace(line)) > 0
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if n == 1 {
+			var h header
+			if err := json.Unmarshal(line, &h); err != nil || h.Schema == 0 {
+				return nil, false, fmt.Errorf("%s is not a history file", path)
+			}
+			if h.Schema > SchemaVersion {
+				return nil, false, fmt.Errorf("%s has schema version %d, newer than this program understands (%d)", path, h.Schema, SchemaVersion)
+			}
+			continue
+		}
+		var report dnsbench.Report
+		if err := json.Unmarshal(line, &report); err != nil {
+			return nil, false, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		runs = append(runs, report)
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartedAt.Before(runs[j].StartedAt) })
+	return runs, torn, nil
+}
+
+// Runs returns every run, oldest first.
+func (s *Store) Runs() []dnsbench.Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]dnsbench.Report(nil), s.runs...)
+}
+
+// Add appends report to the file.
+func (s *Store) Add(report dnsbench.Report) error {
+	line, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	unlock, err := lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		writeHeader(&buf)
+	}
+	buf.Write(line)
+	buf.WriteByte('\n')
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	s.runs = insert(s.runs, report)
+	return nil
+}
+
+// Import adds the runs that are not in the store yet, as identified by
+// their start time, in a single rewrite of the file.
+func (s *Store) Import(runs []dnsbench.Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(func(stored []dnsbench.Report) ([]dnsbench.Report, bool) {
+		added := false
+		for _, report := range runs {
+			if !has(stored, report.StartedAt) {
+				stored = insert(stored, report)
+				added = true
+			}
+		}
+		return stored, added
+	})
+}
+
+// Prune drops the runs that r no longer keeps at now and returns how many
+// were dropped.
+func (s *Store) Prune(r settings.Retention, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := 0
+	err := s.update(func(runs []dnsbench.Report) ([]dnsbench.Report, bool) {
+		kept := r.Apply(runs, now)
+		dropped = len(runs) - len(kept)
+		return append([]dnsbench.Report(nil), kept...), dropped > 0
+	})
+	if err != nil {
+		return 0, err
+	}
+	return dropped, nil
+}
+
+// Query selects runs. Zero fields match every run.
+type Query struct {
+	// Since and Until bound the start time of the run, inclusively.
+	Since, Until time.Time
+	// Provider matches runs that tested a provider of that name.
+	Provider string
+	// Domain matches runs that queried the domain.
+	Domain string
+	// QueryType matches the record type asked for, e.g. "AAAA".
+	QueryType string
+	// Transport matches runs that sent any query over it.
+	Transport dnsbench.Transport
+}
+
+// Match reports whether report is selected by q.
+func (q Query) Match(report dnsbench.Report) bool {
+	if !q.Since.IsZero() && report.StartedAt.Before(q.Since) ||
+		!q.Until.IsZero() && report.StartedAt.After(q.Until) {
+		return false
+	}
+	if q.QueryType != "" && !queriedType(report.Config, q.QueryType) {
+		return false
+	}
+	if q.Domain != "" && !containsFold(queriedDomains(report.Config), q.Domain) {
+		return false
+	}
+	if q.Provider != "" || q.Transport != "" {
+		found := false
+		for _, r := range report.Results {
+			if q.Provider != "" && !strings.EqualFold(r.Provider.Name, q.Provider) {
+				continue
+			}
+			if q.Transport == "" || usedTransport(r, q.Transport) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// queriedType reports whether a run with config asked any domain for
+// records of type t.
+func queriedType(config dnsbench.TestConfig, t string) bool {
+	for _, domain := range queriedDomains(config) {
+		if containsFold(config.Types(domain), t) {
+			return true
+		}
+	}
+	return false
+}
+
+// queriedDomains is the domains a run with config asked for, which are
+// the default ones if it did not list any.
+func queriedDomains(config dnsbench.TestConfig) []string {
+	if len(config.Domains) == 0 {
+		return dnsbench.DefaultDomains
+	}
+	return config.Domains
+}
+
+// Query returns the runs q selects, oldest first.
+func (s *Store) Query(q Query) []dnsbench.Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var runs []dnsbench.Report
+	for _, report := range s.runs {
+		if q.Match(report) {
+			runs = append(runs, report)
+		}
+	}
+	return runs
+}
+
+func usedTransport(r dnsbench.TestResult, t dnsbench.Transport) bool {
+	for _, q := range r.Queries {
+		if q.Transport == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// has reports whether a run that started at t is in runs.
+func has(runs []dnsbench.Report, t time.Time) bool {
+	for _, report := range runs {
+		if report.StartedAt.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// insert adds report to runs, keeping them in order.
+func insert(runs []dnsbench.Report, report dnsbench.Report) []dnsbench.Report {
+	i := sort.Search(len(runs), func(i int) bool { return runs[i].StartedAt.After(report.StartedAt) })
+	runs = append(runs, dnsbench.Report{})
+	copy(runs[i+1:], runs[i:])
+	runs[i] = report
+	return runs
+}
+
+// update reads the file again holding the lock, so that runs other
+// processes added since s was opened are kept, applies change to its runs
+// and rewrites it if change reports a change or an incomplete last line
+// has to be dropped. s.runs is left matching the file. s.mu must be held.
+func (s *Store) update(change func([]dnsbench.Report) ([]dnsbench.Report, bool)) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	unlock, err := lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	runs, torn, err := readFile(s.path)
+	if err != nil {
+		return err
+	}
+	runs, changed := change(runs)
+	if changed || torn {
+		var buf bytes.Buffer
+		writeHeader(&buf)
+		enc := json.NewEncoder(&buf)
+		for _, report := range runs {
+			if err := enc.Encode(report); err != nil {
+				return err
+			}
+		}
+		if err := atomicfile.WriteFile(s.path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	s.runs = runs
+	return nil
+}
+
+func writeHeader(buf *bytes.Buffer) {
+	b, _ := json.Marshal(header{Schema: SchemaVersion})
+	buf.Write(b)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,257 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/settings"
+)
+
+func day(d int) time.Time { return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC) }
+
+func run(d int, provider string, transport dnsbench.Transport) dnsbench.Report {
+	return dnsbench.Report{
+		StartedAt: day(d),
+		Config:    dnsbench.TestConfig{QueryType: "A", Domains: []string{"example.com"}},
+		Results: []dnsbench.TestResult{{
+			Provider: dnsbench.DNSProvider{Name: provider},
+			Queries:  []dnsbench.QueryResult{{Provider: provider, Domain: "example.com", Transport: transport}},
+		}},
+	}
+}
+
+func startDays(runs []dnsbench.Report) []int {
+	var days []int
+	for _, r := range runs {
+		days = append(days, r.StartedAt.Day())
+	}
+	return days
+}
+
+func TestAddAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []int{2, 3, 1} {
+		if err := s.Add(run(d, "Google", dnsbench.TransportUDP)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := startDays(s.Runs()); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("runs from days %v, want 1, 2, 3", got)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := reopened.Runs()
+	if got := startDays(runs); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("reopened runs from days %v, want 1, 2, 3", got)
+	}
+	if runs[0].Results[0].Provider.Name != "Google" || runs[0].Config.Domains[0] != "example.com" {
+		t.Errorf("run not stored in full: %+v", runs[0])
+	}
+}
+
+func TestTornAppendIsDropped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, _ := Open(path)
+	if err := s.Add(run(1, "Google", dnsbench.TransportUDP)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"StartedAt":"2024-05-02T12:00:00Z","Resu`)
+	f.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(run(3, "Google", dnsbench.TransportUDP)); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := startDays(s.Runs()); !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("runs from days %v, want 1 and 3", got)
+	}
+}
+
+func TestOpenLeavesAppendInProgress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, _ := Open(path)
+	if err := s.Add(run(1, "Google", dnsbench.TransportUDP)); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"StartedAt":"2024-05-02T12:00:00Z","Resu`)
+
+	opened := make(chan error, 1)
+	go func() {
+		_, err := Open(path)
+		opened <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	f.WriteString(`lts":null}` + "\n")
+	f.Close()
+	unlock()
+	if err := <-opened; err != nil {
+		t.Fatal(err)
+	}
+	s, _ = Open(path)
+	if got := startDays(s.Runs()); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("runs from days %v, want 1 and 2", got)
+	}
+}
+
+func TestPruneKeepsRunsAddedElsewhere(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	gui, _ := Open(path)
+	gui.Add(run(1, "Google", dnsbench.TransportUDP))
+	cli, _ := Open(path)
+	for d := 2; d <= 4; d++ {
+		if err := cli.Add(run(d, "Google", dnsbench.TransportUDP)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dropped, err := gui.Prune(settings.Retention{MaxRuns: 3}, day(5))
+	if err != nil || dropped != 1 {
+		t.Fatalf("dropped %d runs, %v; want 1", dropped, err)
+	}
+	if got := startDays(gui.Runs()); !reflect.DeepEqual(got, []int{2, 3, 4}) {
+		t.Errorf("runs from days %v after pruning, want 2, 3, 4", got)
+	}
+	s, _ := Open(path)
+	if got := startDays(s.Runs()); !reflect.DeepEqual(got, []int{2, 3, 4}) {
+		t.Errorf("file holds runs from days %v, want 2, 3, 4", got)
+	}
+}
+
+func TestOpenRefusesBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"newer":   `{"Schema":99}` + "\n",
+		"corrupt": `{"Schema":1}` + "\n" + "not json\n" + `{"StartedAt":"2024-05-02T12:00:00Z"}` + "\n",
+		"foreign": `[1, 2, 3]` + "\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Open(path); err == nil {
+			t.Errorf("%s: opened without error", name)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, _ := Open(path)
+	for d := 1; d <= 5; d++ {
+		s.Add(run(d, "Google", dnsbench.TransportUDP))
+	}
+	dropped, err := s.Prune(settings.Retention{MaxRuns: 3}, day(6))
+	if err != nil || dropped != 2 {
+		t.Fatalf("dropped %d runs, %v; want 2", dropped, err)
+	}
+	s, _ = Open(path)
+	if got := startDays(s.Runs()); !reflect.DeepEqual(got, []int{3, 4, 5}) {
+		t.Errorf("runs from days %v after pruning, want 3, 4, 5", got)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	s, _ := Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	s.Add(run(1, "Google", dnsbench.TransportUDP))
+	mx := run(2, "Cloudflare", dnsbench.TransportDoT)
+	mx.Config.DomainTypes = map[string][]string{"example.com": {"A", "MX"}}
+	s.Add(mx)
+	aaaa := run(3, "Google", dnsbench.TransportDoH)
+	aaaa.Config.QueryType = "AAAA"
+	aaaa.Config.Domains = []string{"example.net"}
+	s.Add(aaaa)
+	defaults := run(4, "Google", dnsbench.TransportUDP)
+	defaults.Config.Domains = nil
+	s.Add(defaults)
+
+	tests := []struct {
+		name string
+		q    Query
+		want []int
+	}{
+		{"all", Query{}, []int{1, 2, 3, 4}},
+		{"since", Query{Since: day(2)}, []int{2, 3, 4}},
+		{"until", Query{Until: day(2)}, []int{1, 2}},
+		{"provider", Query{Provider: "google"}, []int{1, 3, 4}},
+		{"transport", Query{Transport: dnsbench.TransportDoT}, []int{2}},
+		{"provider and transport", Query{Provider: "Google", Transport: dnsbench.TransportDoT}, nil},
+		{"query type", Query{QueryType: "aaaa"}, []int{3}},
+		{"per-domain query type", Query{QueryType: "MX"}, []int{2}},
+		{"default query type", Query{QueryType: "A"}, []int{1, 2, 4}},
+		{"domain", Query{Domain: "example.com"}, []int{1, 2}},
+		{"default domain", Query{Domain: dnsbench.DefaultDomains[0]}, []int{4}},
+	}
+	for _, tt := range tests {
+		if got := startDays(s.Query(tt.q)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: runs from days %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadMigratesSettings(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+	path, err := settings.Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := `{"tests_per_domain": 5, "test_history": [[{"Provider": {"Name": "Google"}, "TimeStamp": "2024-05-01T12:00:00Z"}]]}`
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		s, err := settings.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		store, err := Load(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs := store.Runs()
+		if len(runs) != 1 || !runs[0].StartedAt.Equal(day(1)) || runs[0].Results[0].Provider.Name != "Google" {
+			t.Fatalf("load %d: store holds %+v, want the migrated run", i+1, runs)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Google") || !strings.Contains(string(data), `"tests_per_domain": 5`) {
+		t.Errorf("settings.json after migration:\n%s", data)
+	}
+}
@@ -0,0 +1,42 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// lockWait is how long a writer waits for another one to finish.
+	lockWait = 10 * time.Second
+	// lockStale is the age after which a lock file is taken to be left
+	// by a process that died holding it. Writes take milliseconds.
+	lockStale = time.Minute
+)
+
+// lock takes the lock file next to path, which every process changing
+// the history file holds while it appends to or replaces it, and returns
+// the function that releases it.
+func lock(path string) (unlock func(), err error) {
+	name := path + ".lock"
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(name)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another process", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
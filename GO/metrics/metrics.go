@@ -0,0 +1,280 @@
+// Package metrics exposes benchmark results to Prometheus.
+//
+// A Registry is fed every query and every finished run, and writes what it
+// has seen in the Prometheus text exposition format: a latency histogram
+// and a query counter per provider, transport and record type, and gauges
+// describing each provider's latest run.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dns_speed_test/dnsbench"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency
+// histogram buckets.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Registry accumulates metrics. It is safe for concurrent use, so it can be
+// fed from a run's query callback while being scraped.
+type Registry struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	latency  map[series]*histogram
+	queries  map[queryKey]uint64
+	runs     uint64
+	lastRuns map[string]lastRun
+	degraded map[string]bool
+}
+
+type series struct {
+	provider  string
+	transport dnsbench.Transport
+	qtype     string
+}
+
+type queryKey struct {
+	series
+	rcode  string
+	result string
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+type lastRun struct {
+	at      time.Time
+	success bool
+	median  time.Duration
+	loss    float64
+}
+
+// New returns an empty Registry using DefaultBuckets.
+func New() *Registry {
+	return &Registry{
+		buckets:  DefaultBuckets,
+		latency:  make(map[series]*histogram),
+		queries:  make(map[queryKey]uint64),
+		lastRuns: make(map[string]lastRun),
+		degraded: make(map[string]bool),
+	}
+}
+
+// ObserveQuery counts q and, when a response came back, adds its latency to
+// the histogram. Its signature suits the onQuery callback of dnsbench.Run.
+func (r *Registry) ObserveQuery(q dnsbench.QueryResult) {
+	s := series{provider: q.Provider, transport: q.Transport, qtype: q.QueryType}
+	key := queryKey{series: s, rcode: q.Rcode, result: "success"}
+	if key.rcode == "" {
+		// Timeouts and network errors.
+		key.rcode = "none"
+	}
+	if !q.Success {
+		key.result = "failure"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries[key]++
+	if q.Rcode == "" {
+		return
+	}
+	h := r.latency[s]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(r.buckets))}
+		r.latency[s] = h
+	}
+	seconds := q.Latency.Seconds()
+	if i := sort.SearchFloat64s(r.buckets, seconds); i < len(r.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// ObserveRun records report as the latest run of each provider in it.
+// Providers whose run was cancelled before any query finished are left as
+// they were.
+func (r *Registry) ObserveRun(report dnsbench.Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs++
+	for _, result := range report.Results {
+		if result.Cancelled && result.TestsDone == 0 {
+			continue
+		}
+		r.lastRuns[result.Provider.Name] = lastRun{
+			at:      report.StartedAt,
+			success: result.Success,
+			median:  result.Median,
+			loss:    result.Loss,
+		}
+	}
+}
+
+// SetDegraded records whether monitoring considers provider degraded.
+func (r *Registry) SetDegraded(provider string, degraded bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.degraded[provider] = degraded
+}
+
+// ServeHTTP writes the metrics for a Prometheus scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+
+	family(&b, "dns_speed_test_query_duration_seconds", "histogram", "Latency of queries that got a response.")
+	for _, s := range sortedSeries(r.latency) {
+		h := r.latency[s]
+		labels := []string{"provider", s.provider, "transport", string(s.transport), "type", s.qtype}
+		var cumulative uint64
+		for i, le := range r.buckets {
+			cumulative += h.counts[i]
+			sample(&b, "dns_speed_test_query_duration_seconds_bucket", append(labels, "le", formatFloat(le)), float64(cumulative))
+		}
+		sample(&b, "dns_speed_test_query_duration_seconds_bucket", append(labels, "le", "+Inf"), float64(h.count))
+		sample(&b, "dns_speed_test_query_duration_seconds_sum", labels, h.sum)
+		sample(&b, "dns_speed_test_query_duration_seconds_count", labels, float64(h.count))
+	}
+
+	family(&b, "dns_speed_test_queries_total", "counter", "Queries sent, by response code (none when no response came back) and result.")
+	keys := make([]queryKey, 0, len(r.queries))
+	for k := range r.queries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.series != b.series {
+			return seriesLess(a.series, b.series)
+		}
+		if a.rcode != b.rcode {
+			return a.rcode < b.rcode
+		}
+		return a.result < b.result
+	})
+	for _, k := range keys {
+		sample(&b, "dns_speed_test_queries_total",
+			[]string{"provider", k.provider, "transport", string(k.transport), "type", k.qtype, "rcode", k.rcode, "result", k.result},
+			float64(r.queries[k]))
+	}
+
+	family(&b, "dns_speed_test_runs_total", "counter", "Benchmark runs finished.")
+	sample(&b, "dns_speed_test_runs_total", nil, float64(r.runs))
+
+	providers := make([]string, 0, len(r.lastRuns))
+	for p := range r.lastRuns {
+		providers = append(providers, p)
+	}
+	sort.Strings(providers)
+	for _, g := range []struct {
+		name, help string
+		value      func(lastRun) float64
+	}{
+		{"dns_speed_test_last_run_timestamp_seconds", "Start time of the provider's latest run.", func(l lastRun) float64 {
+			return float64(l.at.UnixNano()) / 1e9
+		}},
+		{"dns_speed_test_last_run_success", "Whether any query succeeded in the provider's latest run.", func(l lastRun) float64 {
+			return boolValue(l.success)
+		}},
+		{"dns_speed_test_last_run_median_latency_seconds", "Median latency of the provider's latest run.", func(l lastRun) float64 {
+			return l.median.Seconds()
+		}},
+		{"dns_speed_test_last_run_loss_ratio", "Share of the queries that failed in the provider's latest run.", func(l lastRun) float64 {
+			return l.loss / 100
+		}},
+	} {
+		family(&b, g.name, "gauge", g.help)
+		for _, p := range providers {
+			sample(&b, g.name, []string{"provider", p}, g.value(r.lastRuns[p]))
+		}
+	}
+
+	if len(r.degraded) > 0 {
+		family(&b, "dns_speed_test_provider_degraded", "gauge", "Whether monitoring considers the provider degraded.")
+		degraded := make([]string, 0, len(r.degraded))
+		for p := range r.degraded {
+			degraded = append(degraded, p)
+		}
+		sort.Strings(degraded)
+		for _, p := range degraded {
+			sample(&b, "dns_speed_test_provider_degraded", []string{"provider", p}, boolValue(r.degraded[p]))
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func family(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one line; labels alternate between names and values.
+func sample(b *strings.Builder, name string, labels []string, value float64) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(value))
+	b.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedSeries(m map[series]*histogram) []series {
+	keys := make([]series, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return seriesLess(keys[i], keys[j]) })
+	return keys
+}
+
+func seriesLess(a, b series) bool {
+	if a.provider != b.provider {
+		return a.provider < b.provider
+	}
+	if a.transport != b.transport {
+		return a.transport < b.transport
+	}
+	return a.qtype < b.qtype
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench"
+)
+
+func TestRegistry(t *testing.T) {
+	r := New()
+	for _, q := range []dnsbench.QueryResult{
+		{Provider: "Google", Transport: dnsbench.TransportUDP, Latency: 3 * time.Millisecond, Success: true, QueryType: "A", Rcode: "NOERROR"},
+		{Provider: "Google", Transport: dnsbench.TransportUDP, Latency: 45 * time.Millisecond, Success: true, QueryType: "A", Rcode: "NOERROR"},
+		{Provider: "Google", Transport: dnsbench.TransportUDP, Latency: 5 * time.Second, QueryType: "A", Error: "timeout"},
+		{Provider: `Lab "2"`, Transport: dnsbench.TransportDoT, Latency: 10 * time.Millisecond, QueryType: "HTTPS", Rcode: "SERVFAIL"},
+	} {
+		r.ObserveQuery(q)
+	}
+	started := time.Unix(1700000000, 0)
+	r.ObserveRun(dnsbench.Report{StartedAt: started, Results: []dnsbench.TestResult{
+		{Provider: dnsbench.DNSProvider{Name: "Google"}, Success: true, TestsDone: 3, Stats: dnsbench.Stats{Median: 20 * time.Millisecond, Loss: 25}},
+		{Provider: dnsbench.DNSProvider{Name: "Skipped"}, Cancelled: true},
+	}})
+	r.SetDegraded("Google", true)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %q", ct)
+	}
+	out := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE dns_speed_test_query_duration_seconds histogram\n",
+		`dns_speed_test_query_duration_seconds_bucket{provider="Google",transport="udp",type="A",le="0.0025"} 0` + "\n",
+		`dns_speed_test_query_duration_seconds_bucket{provider="Google",transport="udp",type="A",le="0.005"} 1` + "\n",
+		`dns_speed_test_query_duration_seconds_bucket{provider="Google",transport="udp",type="A",le="0.05"} 2` + "\n",
+		`dns_speed_test_query_duration_seconds_bucket{provider="Google",transport="udp",type="A",le="+Inf"} 2` + "\n",
+		`dns_speed_test_query_duration_seconds_sum{provider="Google",transport="udp",type="A"} 0.048` + "\n",
+		`dns_speed_test_query_duration_seconds_count{provider="Lab \"2\"",transport="dot",type="HTTPS"} 1` + "\n",
+		`dns_speed_test_queries_total{provider="Google",transport="udp",type="A",rcode="NOERROR",result="success"} 2` + "\n",
+		`dns_speed_test_queries_total{provider="Google",transport="udp",type="A",rcode="none",result="failure"} 1` + "\n",
+		`dns_speed_test_queries_total{provider="Lab \"2\"",transport="dot",type="HTTPS",rcode="SERVFAIL",result="failure"} 1` + "\n",
+		"dns_speed_test_runs_total 1\n",
+		`dns_speed_test_last_run_timestamp_seconds{provider="Google"} 1.7e+09` + "\n",
+		`dns_speed_test_last_run_success{provider="Google"} 1` + "\n",
+		`dns_speed_test_last_run_median_latency_seconds{provider="Google"} 0.02` + "\n",
+		`dns_speed_test_last_run_loss_ratio{provider="Google"} 0.25` + "\n",
+		`dns_speed_test_provider_degraded{provider="Google"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	if strings.Contains(out, "Skipped") {
+		t.Error("provider cancelled before any query has run metrics")
+	}
+	if t.Failed() {
+		t.Log(out)
+	}
+}
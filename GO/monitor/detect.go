@@ -0,0 +1,191 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"dns_speed_test/dnsbench"
+)
+
+// Thresholds decide when a provider counts as degraded, relative to its
+// baseline: its results over the last Window healthy runs.
+type Thresholds struct {
+	Window int
+	// MinRuns is the number of baseline runs needed before any alert.
+	MinRuns int
+	// A run's median latency is degraded when it is both LatencyFactor
+	// times the baseline median and LatencyMargin slower than it.
+	LatencyFactor float64
+	LatencyMargin time.Duration
+	// Loss is degraded when it exceeds the baseline loss by LossPoints
+	// percentage points.
+	LossPoints float64
+}
+
+// DefaultThresholds alert when latency doubles and grows by 20ms, or when
+// another fifth of the queries fail.
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		Window:        12,
+		MinRuns:       3,
+		LatencyFactor: 2,
+		LatencyMargin: 20 * time.Millisecond,
+		LossPoints:    20,
+	}
+}
+
+// Kinds of Alert.
+const (
+	AlertLatency   = "latency"
+	AlertFailures  = "failures"
+	AlertRecovered = "recovered"
+)
+
+// Alert reports that a provider became degraded or recovered.
+type Alert struct {
+	Time     time.Time
+	Provider string
+	Kind     string
+	Detail   string
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("%s: %s %s", a.Provider, a.Kind, a.Detail)
+}
+
+// Rolling is a provider's baseline and latest run.
+type Rolling struct {
+	Provider string
+	// Runs is the number of runs in the baseline.
+	Runs int
+	// Median is the median of the baseline runs' median latencies, and
+	// Loss their mean loss.
+	Median time.Duration
+	Loss   float64
+	// LastMedian and LastLoss are from the latest run.
+	LastMedian time.Duration
+	LastLoss   float64
+	// Degraded is set while an alert for the provider is outstanding.
+	Degraded bool
+}
+
+// Detector follows providers across runs and raises an Alert when one
+// degrades and when it recovers. It is not safe for concurrent use.
+type Detector struct {
+	Thresholds
+	providers map[string]*baseline
+	order     []string
+}
+
+type baseline struct {
+	medians       []time.Duration
+	losses        []float64
+	slow, failing bool
+	lastMedian    time.Duration
+	lastLoss      float64
+}
+
+// NewDetector returns a Detector with no baseline yet.
+func NewDetector(t Thresholds) *Detector {
+	return &Detector{Thresholds: t, providers: make(map[string]*baseline)}
+}
+
+// Observe compares every provider in report with its baseline, returns the
+// alerts for changes in their state, and adds the healthy results to the
+// baselines.
+func (d *Detector) Observe(report dnsbench.Report) []Alert {
+	var alerts []Alert
+	for _, r := range report.Results {
+		if r.Cancelled && r.TestsDone == 0 {
+			continue
+		}
+		name := r.Provider.Name
+		b, ok := d.providers[name]
+		if !ok {
+			b = new(baseline)
+			d.providers[name] = b
+			d.order = append(d.order, name)
+		}
+		alert := func(kind, format string, args ...any) {
+			alerts = append(alerts, Alert{Time: report.StartedAt, Provider: name, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+		}
+
+		wasDegraded := b.slow || b.failing
+		enough := len(b.losses) >= d.MinRuns
+		median, loss := b.median(), b.loss()
+		failing := enough && r.Loss-loss >= d.LossPoints
+		slow := b.slow
+		if r.Success {
+			slow = enough && len(b.medians) > 0 &&
+				float64(r.Median) >= d.LatencyFactor*float64(median) && r.Median-median >= d.LatencyMargin
+		}
+		if slow && !b.slow {
+			alert(AlertLatency, "median %v against a baseline of %v", r.Median.Round(100*time.Microsecond), median.Round(100*time.Microsecond))
+		}
+		if failing && !b.failing {
+			alert(AlertFailures, "%.0f%% of queries failed against a baseline of %.0f%%", r.Loss, loss)
+		}
+		if wasDegraded && !slow && !failing {
+			alert(AlertRecovered, "median %v, %.0f%% failed", r.Median.Round(100*time.Microsecond), r.Loss)
+		}
+		b.slow, b.failing = slow, failing
+		b.lastMedian, b.lastLoss = r.Median, r.Loss
+
+		if !slow && !failing {
+			if r.Success {
+				b.medians = appendWindow(b.medians, r.Median, d.Window)
+			}
+			b.losses = appendWindow(b.losses, r.Loss, d.Window)
+		}
+	}
+	return alerts
+}
+
+// Rolling returns the state of every provider seen so far, in the order
+// they first appeared.
+func (d *Detector) Rolling() []Rolling {
+	var rolling []Rolling
+	for _, name := range d.order {
+		b := d.providers[name]
+		rolling = append(rolling, Rolling{
+			Provider:   name,
+			Runs:       len(b.losses),
+			Median:     b.median(),
+			Loss:       b.loss(),
+			LastMedian: b.lastMedian,
+			LastLoss:   b.lastLoss,
+			Degraded:   b.slow || b.failing,
+		})
+	}
+	return rolling
+}
+
+func (b *baseline) median() time.Duration {
+	if len(b.medians) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), b.medians...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+func (b *baseline) loss() float64 {
+	if len(b.losses) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, l := range b.losses {
+		sum += l
+	}
+	return sum / float64(len(b.losses))
+}
+
+// appendWindow appends v and keeps the last n values.
+func appendWindow[T any](values []T, v T, n int) []T {
+	values = append(values, v)
+	if n > 0 && len(values) > n {
+		values = values[len(values)-n:]
+	}
+	return values
+}
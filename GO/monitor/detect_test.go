@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench"
+)
+
+func report(results ...dnsbench.TestResult) dnsbench.Report {
+	return dnsbench.Report{StartedAt: time.Now(), Results: results}
+}
+
+func result(name string, median time.Duration, loss float64) dnsbench.TestResult {
+	r := dnsbench.TestResult{Provider: dnsbench.DNSProvider{Name: name}, Success: loss < 100, TestsDone: 10, Stats: dnsbench.Stats{Median: median, Loss: loss}}
+	if !r.Success {
+		r.Median = 0
+	}
+	return r
+}
+
+func kinds(alerts []Alert) []string {
+	var k []string
+	for _, a := range alerts {
+		k = append(k, a.Provider+" "+a.Kind)
+	}
+	return k
+}
+
+func TestDetector(t *testing.T) {
+	ms := time.Millisecond
+	d := NewDetector(DefaultThresholds())
+	steps := []struct {
+		name    string
+		results []dnsbench.TestResult
+		want    []string
+	}{
+		{"first", []dnsbench.TestResult{result("A", 10*ms, 0), result("B", 20*ms, 0)}, nil},
+		// Too few runs for a baseline yet.
+		{"early spike", []dnsbench.TestResult{result("A", 100*ms, 0), result("B", 20*ms, 0)}, nil},
+		{"third", []dnsbench.TestResult{result("A", 10*ms, 0), result("B", 20*ms, 0)}, nil},
+		{"fourth", []dnsbench.TestResult{result("A", 11*ms, 0), result("B", 21*ms, 0)}, nil},
+		// Doubled, but by less than the margin.
+		{"small rise", []dnsbench.TestResult{result("A", 25*ms, 0), result("B", 20*ms, 0)}, nil},
+		{"slow", []dnsbench.TestResult{result("A", 80*ms, 0), result("B", 20*ms, 0)}, []string{"A latency"}},
+		{"still slow", []dnsbench.TestResult{result("A", 90*ms, 0), result("B", 20*ms, 0)}, nil},
+		{"failing", []dnsbench.TestResult{result("A", 10*ms, 0), result("B", 0, 100)}, []string{"A recovered", "B failures"}},
+		// A run with no answers says nothing about latency.
+		{"still failing", []dnsbench.TestResult{result("A", 10*ms, 0), result("B", 0, 100)}, nil},
+		{"partly", []dnsbench.TestResult{result("A", 10*ms, 0), result("B", 20*ms, 10)}, []string{"B recovered"}},
+	}
+	for _, step := range steps {
+		if got := kinds(d.Observe(report(step.results...))); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: alerts %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	rolling := d.Rolling()
+	if len(rolling) != 2 || rolling[0].Provider != "A" || rolling[1].Provider != "B" {
+		t.Fatalf("rolling stats %+v", rolling)
+	}
+	// The degraded runs of A stay out of its baseline.
+	if a := rolling[0]; a.Runs != 8 || a.Median != 10*ms || a.Degraded {
+		t.Errorf("A: %+v", a)
+	}
+	if b := rolling[1]; b.Runs != 8 || b.Loss != 1.25 || b.LastLoss != 10 {
+		t.Errorf("B: %+v", b)
+	}
+}
+
+func TestDetectorWindow(t *testing.T) {
+	d := NewDetector(Thresholds{Window: 3, MinRuns: 3, LatencyFactor: 2, LatencyMargin: time.Millisecond, LossPoints: 20})
+	for _, median := range []time.Duration{10, 10, 10, 15, 19, 25, 30} {
+		if alerts := d.Observe(report(result("A", median*time.Millisecond, 0))); len(alerts) > 0 {
+			t.Errorf("gradual change to %vms raised %v", median, alerts)
+		}
+	}
+	if r := d.Rolling()[0]; r.Runs != 3 || r.Median != 25*time.Millisecond {
+		t.Errorf("baseline over the last 3 runs: %+v", r)
+	}
+}
@@ -0,0 +1,68 @@
+// Package monitor runs benchmarks on a schedule and raises alerts when a
+// provider becomes slower or starts failing compared with its own recent
+// runs.
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"dns_speed_test/dnsbench"
+)
+
+// Monitor benchmarks Providers with Config at every time Schedule gives,
+// and passes the changes Detector sees to every Notifier.
+type Monitor struct {
+	Providers []dnsbench.DNSProvider
+	Config    dnsbench.TestConfig
+	Schedule  Schedule
+	Detector  *Detector
+	Notifiers []Notifier
+	// OnQuery, if set, is passed to dnsbench.Run for every query.
+	OnQuery func(dnsbench.QueryResult)
+	// OnReport, if set, is called after every run with its alerts.
+	OnReport func(report dnsbench.Report, alerts []Alert)
+	// OnError, if set, is called when a notifier fails.
+	OnError func(error)
+}
+
+// Run runs a benchmark straight away and then on the schedule until ctx is
+// done or the schedule has no next time. A run in progress when ctx is done
+// is stopped and not reported.
+func (m *Monitor) Run(ctx context.Context) error {
+	next := time.Now()
+	for {
+		report := dnsbench.Report{StartedAt: time.Now(), Config: m.Config}
+		report.Results = dnsbench.Run(ctx, m.Providers, m.Config, m.OnQuery)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		dnsbench.SortByLatency(report.Results)
+		alerts := m.Detector.Observe(report)
+		for _, a := range alerts {
+			for _, n := range m.Notifiers {
+				if err := n.Notify(ctx, a); err != nil && m.OnError != nil {
+					m.OnError(err)
+				}
+			}
+		}
+		if m.OnReport != nil {
+			m.OnReport(report, alerts)
+		}
+
+		// Starts missed while a run overran are skipped.
+		now := time.Now()
+		for !next.After(now) {
+			if next = m.Schedule.Next(next); next.IsZero() {
+				return nil
+			}
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/dnsbench/dnstest"
+)
+
+func TestMonitorRun(t *testing.T) {
+	server, err := dnstest.NewServer("example.com", dnstest.Faults{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	addr := server.Addr()
+	provider := dnsbench.DNSProvider{Name: "local", IP: addr.Addr().String(), Port: int(addr.Port())}
+
+	posted := make(chan Alert, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Error(err)
+		}
+		posted <- a
+	}))
+	defer hook.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var runs int
+	m := &Monitor{
+		Providers: []dnsbench.DNSProvider{provider},
+		Config:    dnsbench.TestConfig{Domains: []string{"example.com"}, TestsPerDomain: 2, Timeout: 200 * time.Millisecond},
+		Schedule:  Every(20 * time.Millisecond),
+		Detector:  NewDetector(DefaultThresholds()),
+		Notifiers: []Notifier{Webhook{URL: hook.URL}},
+		OnReport: func(report dnsbench.Report, alerts []Alert) {
+			runs++
+			if runs == 3 {
+				server.SetFaults(dnstest.Faults{ServFailRate: 1})
+			}
+			if len(alerts) > 0 {
+				cancel()
+			}
+		},
+		OnError: func(err error) { t.Error(err) },
+	}
+	if err := m.Run(ctx); err != context.Canceled {
+		t.Fatalf("Run returned %v after %d runs", err, runs)
+	}
+	if runs != 4 {
+		t.Errorf("alerted after %d runs, want 4", runs)
+	}
+	select {
+	case a := <-posted:
+		if a.Provider != "local" || a.Kind != AlertFailures {
+			t.Errorf("webhook got %+v", a)
+		}
+	default:
+		t.Error("webhook not called")
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hook.Close()
+	defer close(release)
+
+	start := time.Now()
+	err := Webhook{URL: hook.URL, Timeout: 50 * time.Millisecond}.Notify(context.Background(), Alert{Provider: "local"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Notify returned %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Notify took %v", d)
+	}
+}
@@ -0,0 +1,112 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// Notifier passes alerts on to a person.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// WriterNotifier writes each alert as a line to W.
+type WriterNotifier struct {
+	W io.Writer
+}
+
+func (n WriterNotifier) Notify(ctx context.Context, a Alert) error {
+	_, err := fmt.Fprintf(n.W, "%s ALERT %s\n", a.Time.Format("2006-01-02 15:04:05"), a)
+	return err
+}
+
+// DefaultWebhookTimeout bounds a webhook call whose Timeout is zero, so
+// that a hook that never answers cannot hold up the monitor.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// Webhook posts each alert as a JSON object to URL.
+type Webhook struct {
+	URL string
+	// Client is http.DefaultClient if nil.
+	Client *http.Client
+	// Timeout is DefaultWebhookTimeout if zero.
+	Timeout time.Duration
+}
+
+func (w Webhook) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	timeout := w.Timeout
+	if timeout == 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+// Desktop shows each alert as a desktop notification, with notify-send on
+// Linux and the BSDs, osascript on macOS and PowerShell on Windows.
+type Desktop struct{}
+
+const notificationTitle = "DNS Speed Test"
+
+func (Desktop) Notify(ctx context.Context, a Alert) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "osascript", "-e",
+			`display notification (system attribute "DNS_ALERT") with title "`+notificationTitle+`"`)
+	case "windows":
+		// The balloon stays up only while PowerShell runs, so it is not
+		// waited for.
+		cmd = exec.Command("powershell", "-NoProfile", "-Command",
+			`Add-Type -AssemblyName System.Windows.Forms; `+
+				`$n = New-Object System.Windows.Forms.NotifyIcon; `+
+				`$n.Icon = [System.Drawing.SystemIcons]::Warning; $n.Visible = $true; `+
+				`$n.ShowBalloonTip(10000, '`+notificationTitle+`', $env:DNS_ALERT, 'Warning'); `+
+				`Start-Sleep -Seconds 10; $n.Dispose()`)
+	default:
+		cmd = exec.CommandContext(ctx, "notify-send", notificationTitle, a.String())
+	}
+	// The message goes through the environment so that it needs no quoting.
+	cmd.Env = append(os.Environ(), "DNS_ALERT="+a.String())
+	if runtime.GOOS == "windows" {
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		go cmd.Wait()
+		return nil
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("desktop notification: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	s, err := ParseSchedule("5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC)
+	if got := s.Next(start); !got.Equal(start.Add(5 * time.Minute)) {
+		t.Errorf("every 5m after %v: %v", start, got)
+	}
+	for _, bad := range []string{"", "10ms", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseSchedule(bad); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		expr, after, want string
+	}{
+		{"* * * * *", "2024-05-01 12:00", "2024-05-01 12:01"},
+		{"*/15 * * * *", "2024-05-01 12:07", "2024-05-01 12:15"},
+		{"*/15 * * * *", "2024-05-01 12:45", "2024-05-01 13:00"},
+		{"30 9-17/4 * * *", "2024-05-01 14:00", "2024-05-01 17:30"},
+		{"0 8 * * 1-5", "2024-05-03 09:00", "2024-05-06 08:00"}, // Friday to Monday
+		{"0 0 * * 7", "2024-05-01 00:00", "2024-05-05 00:00"},   // 7 is Sunday
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		// Both days restricted: the 1st of the month or any Monday.
+		{"0 0 1 * 1", "2024-05-01 00:00", "2024-05-06 00:00"},
+		{"0 0 1,15 * *", "2024-05-20 10:00", "2024-06-01 00:00"},
+		{"@daily", "2024-12-31 23:59", "2025-01-01 00:00"},
+		{"@weekly", "2024-05-01 00:00", "2024-05-05 00:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(at(tt.after)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s: %v, want %s", tt.expr, tt.after, got, tt.want)
+		}
+	}
+
+	never, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := never.Next(at("2024-01-01 00:00")); !got.IsZero() {
+		t.Errorf("February 30th scheduled at %v", got)
+	}
+}
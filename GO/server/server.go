@@ -0,0 +1,437 @@
+// Package server drives the benchmark over HTTP, for machines that cannot
+// show the GUI.
+//
+// It serves a JSON API and a single-page dashboard that uses it:
+//
+//	GET    /api/providers   the providers offered for testing
+//	GET    /api/config      the default TestConfig
+//	POST   /api/runs        start a run; the body is a RunRequest
+//	GET    /api/runs        the runs since the server started, newest first
+//	GET    /api/runs/{id}   a run's progress, and its Report once finished
+//	DELETE /api/runs/{id}   stop a run
+//	GET    /api/history     saved runs, filtered by the query parameters
+//	                        since, until, provider, domain, type and protocol
+//	GET    /metrics         Prometheus metrics, if enabled
+//
+// Requests and responses use the dnsbench types: DNSProvider, TestConfig
+// and Report, whose Results are TestResults.
+//
+// The API has no authentication, so it guards against being driven by web
+// pages open in the user's browser: POST bodies must be sent as
+// application/json, which a page cannot do cross-origin without the
+// browser asking first, requests that change state must come from the
+// dashboard's own origin, and requests addressed to a host name the server
+// does not know, as after DNS rebinding, are refused.
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/history"
+	"dns_speed_test/metrics"
+	"dns_speed_test/settings"
+)
+
+//go:embed dashboard.html
+var dashboard []byte
+
+// keptRuns is how many finished runs GET /api/runs remembers.
+const keptRuns = 20
+
+// Limits on a requested run, so that one request cannot tie the server up
+// for hours.
+const (
+	maxTestsPerDomain = 100
+	maxDomains        = 1000
+	maxProviders      = 100
+)
+
+// Server is an http.Handler for the API and dashboard. Only one run may be
+// in progress at a time.
+type Server struct {
+	// Providers are offered by GET /api/providers and tested when a
+	// request names none.
+	Providers []dnsbench.DNSProvider
+	// Config is used when a request has none.
+	Config dnsbench.TestConfig
+	// Store, if set, receives every finished run and backs /api/history,
+	// and is pruned to Retention.
+	Store     *history.Store
+	Retention settings.Retention
+	// Metrics, if set, is fed every query and run and served at /metrics.
+	Metrics *metrics.Registry
+	// ErrorLog receives failures to save runs; the log package's standard
+	// logger is used if nil.
+	ErrorLog *log.Logger
+	// Hosts are the host names, besides localhost, that requests may be
+	// addressed to. Requests to IP addresses are always accepted.
+	Hosts []string
+
+	mu     sync.Mutex
+	runs   []*run // newest last
+	nextID int
+}
+
+// RunRequest is the body of POST /api/runs. Empty fields take the server's
+// defaults.
+type RunRequest struct {
+	Providers []dnsbench.DNSProvider
+	Config    *dnsbench.TestConfig
+}
+
+// Run states.
+const (
+	StateRunning   = "running"
+	StateDone      = "done"
+	StateCancelled = "cancelled"
+)
+
+// RunStatus describes a run started through the API.
+type RunStatus struct {
+	ID        int
+	State     string
+	StartedAt time.Time
+	// Done is the number of queries finished out of Total.
+	Done, Total int
+	// Report is set once the run has finished.
+	Report *dnsbench.Report
+}
+
+type run struct {
+	id        int
+	startedAt time.Time
+	total     int
+	done      atomic.Int64
+	cancel    context.CancelFunc
+
+	// Guarded by Server.mu.
+	state  string
+	report *dnsbench.Report
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if path != "/metrics" && !s.knownHost(r.Host) {
+		httpError(w, http.StatusForbidden, "unknown host %q", r.Host)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+		httpError(w, http.StatusForbidden, "cross-origin request from %s", r.Header.Get("Origin"))
+		return
+	}
+	switch {
+	case path == "/" || path == "/index.html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboard)
+	case path == "/api/providers":
+		s.get(w, r, func() (any, error) { return s.Providers, nil })
+	case path == "/api/config":
+		s.get(w, r, func() (any, error) { return s.Config, nil })
+	case path == "/api/runs":
+		if r.Method == http.MethodPost {
+			s.startRun(w, r)
+			return
+		}
+		s.get(w, r, func() (any, error) { return s.statuses(), nil })
+	case strings.HasPrefix(path, "/api/runs/"):
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "/api/runs/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.serveRun(w, r, id)
+	case path == "/api/history":
+		s.get(w, r, func() (any, error) { return s.history(r) })
+	case path == "/metrics" && s.Metrics != nil:
+		s.Metrics.ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// get answers a GET request with the JSON encoding of what value returns.
+func (s *Server) get(w http.ResponseWriter, r *http.Request, value func() (any, error)) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		httpError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+	v, err := value()
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// knownHost reports whether host, the Host header of a request, names this
+// server: an IP address, localhost or one of s.Hosts.
+func (s *Server) knownHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+	if net.ParseIP(strings.Trim(host, "[]")) != nil || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	for _, h := range s.Hosts {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether r comes from the dashboard or from a client
+// that is not a browser, which sends no Origin.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func (s *Server) startRun(w http.ResponseWriter, r *http.Request) {
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t != "application/json" {
+		httpError(w, http.StatusUnsupportedMediaType, "the request must be sent as application/json")
+		return
+	}
+	var req RunRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		httpError(w, http.StatusBadRequest, "invalid request: %v", err)
+		return
+	}
+	providers, config, err := s.plan(req)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	s.mu.Lock()
+	if n := len(s.runs); n > 0 && s.runs[n-1].state == StateRunning {
+		s.mu.Unlock()
+		httpError(w, http.StatusConflict, "run %d is still in progress", s.runs[n-1].id)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.nextID++
+	rn := &run{
+		id:        s.nextID,
+		startedAt: time.Now(),
+		total:     len(providers) * config.TotalTests(),
+		cancel:    cancel,
+		state:     StateRunning,
+	}
+	s.runs = append(s.runs, rn)
+	if len(s.runs) > keptRuns {
+		s.runs = s.runs[len(s.runs)-keptRuns:]
+	}
+	status := s.status(rn)
+	s.mu.Unlock()
+
+	go s.execute(ctx, rn, providers, config)
+	w.Header().Set("Location", fmt.Sprintf("/api/runs/%d", rn.id))
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// plan checks a request and fills in the defaults.
+func (s *Server) plan(req RunRequest) ([]dnsbench.DNSProvider, dnsbench.TestConfig, error) {
+	providers := req.Providers
+	if len(providers) == 0 {
+		providers = s.Providers
+	}
+	config := s.Config
+	if req.Config != nil {
+		config = *req.Config
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = dnsbench.DefaultConfig().Timeout
+	}
+	switch {
+	case len(providers) == 0:
+		return nil, config, errors.New("no providers to test")
+	case len(providers) > maxProviders:
+		return nil, config, fmt.Errorf("at most %d providers can be tested at once", maxProviders)
+	case config.TestsPerDomain < 1 || config.TestsPerDomain > maxTestsPerDomain:
+		return nil, config, fmt.Errorf("TestsPerDomain must be between 1 and %d", maxTestsPerDomain)
+	case len(config.Domains) > maxDomains:
+		return nil, config, fmt.Errorf("at most %d domains can be tested at once", maxDomains)
+	}
+	for _, p := range providers {
+		if err := p.Validate(); err != nil {
+			return nil, config, err
+		}
+	}
+	types := []string{config.QueryType}
+	for _, t := range config.DomainTypes {
+		types = append(types, t...)
+	}
+	for _, t := range types {
+		if t != "" && !dnsbench.ValidQueryType(t) {
+			return nil, config, fmt.Errorf("unknown record type %q", t)
+		}
+	}
+	if config.ClientSubnet != "" {
+		if _, err := dnsbench.ParseSubnet(config.ClientSubnet); err != nil {
+			return nil, config, err
+		}
+	}
+	return providers, config, nil
+}
+
+// execute runs a benchmark and records its outcome.
+func (s *Server) execute(ctx context.Context, rn *run, providers []dnsbench.DNSProvider, config dnsbench.TestConfig) {
+	defer rn.cancel()
+	report := dnsbench.Report{StartedAt: rn.startedAt, Config: config}
+	report.Results = dnsbench.Run(ctx, providers, config, func(q dnsbench.QueryResult) {
+		rn.done.Add(1)
+		if s.Metrics != nil {
+			s.Metrics.ObserveQuery(q)
+		}
+	})
+	dnsbench.SortByLatency(report.Results)
+
+	s.mu.Lock()
+	rn.report = &report
+	rn.state = StateDone
+	if ctx.Err() != nil {
+		rn.state = StateCancelled
+	}
+	s.mu.Unlock()
+
+	if s.Metrics != nil {
+		s.Metrics.ObserveRun(report)
+	}
+	if s.Store != nil {
+		err := s.Store.Add(report)
+		if err == nil {
+			_, err = s.Store.Prune(s.Retention, time.Now())
+		}
+		if err != nil {
+			s.logf("run %d not saved: %v", rn.id, err)
+		}
+	}
+}
+
+func (s *Server) serveRun(w http.ResponseWriter, r *http.Request, id int) {
+	s.mu.Lock()
+	var rn *run
+	for _, candidate := range s.runs {
+		if candidate.id == id {
+			rn = candidate
+		}
+	}
+	var status RunStatus
+	if rn != nil {
+		status = s.status(rn)
+	}
+	s.mu.Unlock()
+	if rn == nil {
+		httpError(w, http.StatusNotFound, "no run %d", id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, status)
+	case http.MethodDelete:
+		rn.cancel()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		httpError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+}
+
+// status must be called with s.mu held.
+func (s *Server) status(rn *run) RunStatus {
+	return RunStatus{
+		ID:        rn.id,
+		State:     rn.state,
+		StartedAt: rn.startedAt,
+		Done:      int(rn.done.Load()),
+		Total:     rn.total,
+		Report:    rn.report,
+	}
+}
+
+func (s *Server) statuses() []RunStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := []RunStatus{}
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		statuses = append(statuses, s.status(s.runs[i]))
+	}
+	return statuses
+}
+
+func (s *Server) history(r *http.Request) ([]dnsbench.Report, error) {
+	if s.Store == nil {
+		return []dnsbench.Report{}, nil
+	}
+	params := r.URL.Query()
+	q := history.Query{
+		Provider:  params.Get("provider"),
+		Domain:    params.Get("domain"),
+		QueryType: params.Get("type"),
+		Transport: dnsbench.Transport(params.Get("protocol")),
+	}
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if v := params.Get(bound.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", bound.name, err)
+			}
+			*bound.t = t
+		}
+	}
+	runs := s.Store.Query(q)
+	if runs == nil {
+		runs = []dnsbench.Report{}
+	}
+	return runs, nil
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Error is the body of every response that is not a success.
+type Error struct {
+	Error string
+}
+
+func httpError(w http.ResponseWriter, code int, format string, args ...any) {
+	writeJSON(w, code, Error{Error: fmt.Sprintf(format, args...)})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
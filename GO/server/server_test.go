@@ -0,0 +1,255 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/dnsbench/dnstest"
+	"dns_speed_test/history"
+	"dns_speed_test/metrics"
+)
+
+func newTestServer(t *testing.T, faults dnstest.Faults) (*httptest.Server, *Server) {
+	t.Helper()
+	dns, err := dnstest.NewServer("example.com", faults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dns.Close)
+	addr := dns.Addr()
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Providers: []dnsbench.DNSProvider{{Name: "local", IP: addr.Addr().String(), Port: int(addr.Port())}},
+		Config:    dnsbench.TestConfig{Domains: []string{"example.com"}, TestsPerDomain: 2, Timeout: time.Second},
+		Store:     store,
+		Metrics:   metrics.New(),
+	}
+	hs := httptest.NewServer(s)
+	t.Cleanup(hs.Close)
+	return hs, s
+}
+
+// call sends a request and decodes the JSON response into out, if given.
+func call(t *testing.T, method, url, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method == "POST" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func waitForRun(t *testing.T, url string) RunStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var status RunStatus
+		call(t, "GET", url, "", &status)
+		if status.State != StateRunning {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("run did not finish")
+	return RunStatus{}
+}
+
+func TestRunThroughAPI(t *testing.T) {
+	hs, _ := newTestServer(t, dnstest.Faults{})
+
+	var started RunStatus
+	if code := call(t, "POST", hs.URL+"/api/runs", "", &started); code != http.StatusAccepted {
+		t.Fatalf("POST /api/runs: status %d", code)
+	}
+	if started.ID != 1 || started.State != StateRunning || started.Total != 2 {
+		t.Errorf("started run %+v", started)
+	}
+	status := waitForRun(t, hs.URL+"/api/runs/1")
+	if status.State != StateDone || status.Done != 2 || status.Report == nil {
+		t.Fatalf("finished run %+v", status)
+	}
+	if r := status.Report.Results[0]; !r.Success || r.Provider.Name != "local" || len(r.Queries) != 2 {
+		t.Errorf("result %+v", r)
+	}
+
+	var runs []RunStatus
+	call(t, "GET", hs.URL+"/api/runs", "", &runs)
+	if len(runs) != 1 || runs[0].ID != 1 {
+		t.Errorf("GET /api/runs: %+v", runs)
+	}
+	var saved []dnsbench.Report
+	call(t, "GET", hs.URL+"/api/history?provider=local", "", &saved)
+	if len(saved) != 1 || !saved[0].StartedAt.Equal(status.Report.StartedAt) {
+		t.Errorf("GET /api/history: %d runs", len(saved))
+	}
+	call(t, "GET", hs.URL+"/api/history?provider=other", "", &saved)
+	if len(saved) != 0 {
+		t.Errorf("history filtered by another provider: %d runs", len(saved))
+	}
+
+	resp, err := http.Get(hs.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `dns_speed_test_queries_total{provider="local",transport="udp",type="A",rcode="NOERROR",result="success"} 2`) {
+		t.Errorf("metrics:\n%s", body)
+	}
+}
+
+func TestRequestedRun(t *testing.T) {
+	hs, s := newTestServer(t, dnstest.Faults{})
+	req, _ := json.Marshal(RunRequest{
+		Providers: s.Providers,
+		Config: &dnsbench.TestConfig{
+			Domains:        []string{"example.com", "www.example.com"},
+			TestsPerDomain: 3,
+			QueryType:      "AAAA",
+			DomainTypes:    map[string][]string{"example.com": {"MX", "HTTPS"}},
+		},
+	})
+	var started RunStatus
+	if code := call(t, "POST", hs.URL+"/api/runs", string(req), &started); code != http.StatusAccepted {
+		t.Fatalf("status %d", code)
+	}
+	status := waitForRun(t, hs.URL+"/api/runs/1")
+	if status.Total != 9 || status.Report.Config.QueryType != "AAAA" || status.Report.Config.Timeout == 0 {
+		t.Errorf("run %+v with config %+v", status, status.Report.Config)
+	}
+	if r := status.Report.Results[0]; len(r.TypeStats) != 3 || r.TypeStats["HTTPS"].Loss != 0 {
+		t.Errorf("per-type stats %+v", r.TypeStats)
+	}
+}
+
+func TestStopRun(t *testing.T) {
+	hs, _ := newTestServer(t, dnstest.Faults{Delay: 200 * time.Millisecond})
+	call(t, "POST", hs.URL+"/api/runs", "", nil)
+
+	var e Error
+	if code := call(t, "POST", hs.URL+"/api/runs", "", &e); code != http.StatusConflict {
+		t.Errorf("second run while one is in progress: status %d, %q", code, e.Error)
+	}
+	if code := call(t, "DELETE", hs.URL+"/api/runs/1", "", nil); code != http.StatusNoContent {
+		t.Errorf("DELETE: status %d", code)
+	}
+	if status := waitForRun(t, hs.URL+"/api/runs/1"); status.State != StateCancelled {
+		t.Errorf("stopped run %+v", status)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	hs, _ := newTestServer(t, dnstest.Faults{})
+	tests := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"POST", "/api/runs", "{", http.StatusBadRequest},
+		{"POST", "/api/runs", `{"Config": {"TestsPerDomain": 0}}`, http.StatusBadRequest},
+		{"POST", "/api/runs", `{"Providers": [{"Name": "x", "IP": "not an ip"}]}`, http.StatusBadRequest},
+		{"POST", "/api/runs", `{"Config": {"TestsPerDomain": 1, "DomainTypes": {"example.com": ["MX", "BOGUS"]}}}`, http.StatusBadRequest},
+		{"POST", "/api/runs", `{"Config": {"TestsPerDomain": 1, "ClientSubnet": "nearby"}}`, http.StatusBadRequest},
+		{"GET", "/api/runs/7", "", http.StatusNotFound},
+		{"GET", "/api/runs/x", "", http.StatusNotFound},
+		{"PUT", "/api/providers", "", http.StatusMethodNotAllowed},
+		{"GET", "/api/history?since=yesterday", "", http.StatusBadRequest},
+		{"GET", "/nowhere", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code := call(t, tt.method, hs.URL+tt.path, tt.body, nil); code != tt.code {
+			t.Errorf("%s %s %s: status %d, want %d", tt.method, tt.path, tt.body, code, tt.code)
+		}
+	}
+}
+
+func TestCrossSiteRequests(t *testing.T) {
+	hs, s := newTestServer(t, dnstest.Faults{})
+	s.Hosts = []string{"dns-bench.lan"}
+	tests := []struct {
+		name                      string
+		method, host, origin, typ string
+		code                      int
+	}{
+		{"form post", "POST", "", "", "text/plain", http.StatusUnsupportedMediaType},
+		{"no content type", "POST", "", "", "", http.StatusUnsupportedMediaType},
+		{"other origin", "POST", "", "http://attacker.example", "application/json", http.StatusForbidden},
+		{"other origin stopping a run", "DELETE", "", "http://attacker.example", "", http.StatusForbidden},
+		{"rebound host", "GET", "attacker.example:8053", "", "", http.StatusForbidden},
+		{"rebound host posting", "POST", "attacker.example:8053", "http://attacker.example:8053", "application/json", http.StatusForbidden},
+		{"localhost", "GET", "localhost:8053", "", "", http.StatusOK},
+		{"configured host", "GET", "DNS-Bench.lan:8053", "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		path := "/api/runs"
+		if tt.method == "DELETE" {
+			path += "/1"
+		}
+		req, _ := http.NewRequest(tt.method, hs.URL+path, strings.NewReader("{}"))
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.typ != "" {
+			req.Header.Set("Content-Type", tt.typ)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.code)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", hs.URL+"/api/runs", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", hs.URL)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("same-origin POST: status %d", resp.StatusCode)
+	}
+	waitForRun(t, hs.URL+"/api/runs/1")
+}
+
+func TestDashboard(t *testing.T) {
+	hs, _ := newTestServer(t, dnstest.Faults{})
+	resp, err := http.Get(hs.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || !strings.Contains(string(body), "/api/runs") {
+		t.Errorf("dashboard: %s\n%.200s", resp.Header.Get("Content-Type"), body)
+	}
+}
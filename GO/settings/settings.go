@@ -0,0 +1,270 @@
+// Package settings loads and saves the configuration shared by the GUI and
+// the command-line tool.
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dns_speed_test/dnsbench"
+	"dns_speed_test/internal/atomicfile"
+)
+
+// Settings is the content of settings.json.
+type Settings struct {
+	TestsPerDomain   int           `json:"tests_per_domain"`
+	Timeout          time.Duration `json:"timeout"`
+	UseTCP           bool          `json:"use_tcp"`
+	UseTLS           bool          `json:"use_tls"`
+	UseQUIC          bool          `json:"use_quic"`
+	DoQReconnect     bool          `json:"doq_reconnect"`
+	UseIPv6          bool          `json:"use_ipv6"`
+	ParallelTests    bool          `json:"parallel_tests"`
+	DoHMethod        string        `json:"doh_method"`
+	QueryType        string        `json:"query_type"`
+	UncachedTests    bool          `json:"uncached_tests"`
+	UncachedZone     string        `json:"uncached_zone"`
+	CheckAnswers     bool          `json:"check_answers"`
+	CheckDNSSEC      bool          `json:"check_dnssec"`
+	ClientSubnet     string        `json:"client_subnet"`
+	IdentifyResolver bool          `json:"identify_resolver"`
+	ExportFormat     string        `json:"export_format"`
+	// Providers are the user's own resolvers, and SelectedProviders the
+	// names of the providers ticked on the Test tab.
+	Providers         []Provider `json:"providers"`
+	SelectedProviders []string   `json:"selected_providers"`
+	// DomainSets are named lists of domains to test, and DomainSet the name
+	// of the one runs use.
+	DomainSets []DomainSet `json:"domain_sets"`
+	DomainSet  string      `json:"domain_set"`
+	// Retention limits how many past runs the history store keeps.
+	Retention Retention `json:"retention"`
+	// Monitor is how the GUI repeats runs while monitoring.
+	Monitor Monitor `json:"monitor"`
+	// History is where past runs were kept before they got a store of
+	// their own, and TestHistory how they were kept before they became
+	// Reports. Load moves TestHistory into History, and the history
+	// package moves History into its store.
+	History     []dnsbench.Report       `json:"history,omitempty"`
+	TestHistory [][]dnsbench.TestResult `json:"test_history,omitempty"`
+}
+
+// Provider is a resolver added by the user.
+type Provider struct {
+	dnsbench.DNSProvider
+	// Group is the heading the provider is listed under.
+	Group string
+	// Enabled providers are offered for testing; disabled ones are kept
+	// but hidden.
+	Enabled bool
+}
+
+// DefaultGroup is the group of custom providers that have none.
+const DefaultGroup = "Custom"
+
+// BuiltinGroup is the group the built-in providers are listed under.
+const BuiltinGroup = "Built-in"
+
+// AllProviders is the built-in providers followed by the enabled custom
+// ones.
+func (s Settings) AllProviders() []dnsbench.DNSProvider {
+	all := append([]dnsbench.DNSProvider(nil), dnsbench.DefaultProviders...)
+	for _, p := range s.Providers {
+		if p.Enabled {
+			all = append(all, p.DNSProvider)
+		}
+	}
+	return all
+}
+
+// CheckProvider validates p as the custom provider at index i of
+// s.Providers (-1 for a new one), including that its name is not taken.
+func (s Settings) CheckProvider(p Provider, i int) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	for _, b := range dnsbench.DefaultProviders {
+		if strings.EqualFold(b.Name, p.Name) {
+			return fmt.Errorf("%s: name is taken by a built-in provider", p.Name)
+		}
+	}
+	for j, c := range s.Providers {
+		if j != i && strings.EqualFold(c.Name, p.Name) {
+			return fmt.Errorf("%s: name is already used", p.Name)
+		}
+	}
+	return nil
+}
+
+// DomainSet is a named list of domains to test.
+type DomainSet struct {
+	Name    string
+	Domains []string
+	// Types lists the record types to query for some of the domains, in
+	// the form of dnsbench.TestConfig.DomainTypes.
+	Types map[string][]string
+}
+
+// DefaultDomainSet is the name of the set holding dnsbench.DefaultDomains.
+const DefaultDomainSet = "Popular"
+
+// FindDomainSet looks up a domain set by name, ignoring case.
+func (s Settings) FindDomainSet(name string) (DomainSet, bool) {
+	for _, set := range s.DomainSets {
+		if strings.EqualFold(set.Name, name) {
+			return set, true
+		}
+	}
+	return DomainSet{}, false
+}
+
+// Path is the location of settings.json in the user's config directory.
+func Path() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "dns_speed_test", "settings.json"), nil
+}
+
+// Load reads settings.json. A missing file yields the default settings.
+func Load() (Settings, error) {
+	s := New()
+	path, err := Path()
+	if err != nil {
+		return s, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return s, err
+	}
+	s = Settings{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, err
+	}
+	if len(s.History) == 0 {
+		for _, results := range s.TestHistory {
+			if len(results) > 0 {
+				s.History = append(s.History, dnsbench.Report{StartedAt: results[0].TimeStamp, Results: results})
+			}
+		}
+	}
+	s.TestHistory = nil
+	if len(s.DomainSets) == 0 {
+		s.DomainSets = New().DomainSets
+		s.DomainSet = DefaultDomainSet
+	}
+	if s.Monitor.Schedule == "" {
+		s.Monitor.Schedule = New().Monitor.Schedule
+	}
+	return s, nil
+}
+
+// Save replaces settings.json with s, creating the directory if needed.
+func (s Settings) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, data, 0644)
+}
+
+// New returns the settings of a fresh install.
+func New() Settings {
+	s := Settings{
+		DomainSets: []DomainSet{{Name: DefaultDomainSet, Domains: append([]string(nil), dnsbench.DefaultDomains...)}},
+		DomainSet:  DefaultDomainSet,
+		Monitor:    Monitor{Schedule: "5m"},
+	}
+	s.SetConfig(dnsbench.DefaultConfig())
+	return s
+}
+
+// Config is the TestConfig the settings describe, testing the domains of
+// the selected DomainSet.
+func (s Settings) Config() dnsbench.TestConfig {
+	set, _ := s.FindDomainSet(s.DomainSet)
+	return dnsbench.TestConfig{
+		Domains:          set.Domains,
+		DomainTypes:      set.Types,
+		TestsPerDomain:   s.TestsPerDomain,
+		Timeout:          s.Timeout,
+		UseTCP:           s.UseTCP,
+		UseTLS:           s.UseTLS,
+		UseQUIC:          s.UseQUIC,
+		DoQReconnect:     s.DoQReconnect,
+		UseIPv6:          s.UseIPv6,
+		ParallelTests:    s.ParallelTests,
+		DoHMethod:        s.DoHMethod,
+		QueryType:        s.QueryType,
+		UncachedTests:    s.UncachedTests,
+		UncachedZone:     s.UncachedZone,
+		CheckAnswers:     s.CheckAnswers,
+		CheckDNSSEC:      s.CheckDNSSEC,
+		ClientSubnet:     s.ClientSubnet,
+		IdentifyResolver: s.IdentifyResolver,
+	}
+}
+
+// SetConfig stores the parts of c that are saved between sessions.
+func (s *Settings) SetConfig(c dnsbench.TestConfig) {
+	s.TestsPerDomain = c.TestsPerDomain
+	s.Timeout = c.Timeout
+	s.UseTCP = c.UseTCP
+	s.UseTLS = c.UseTLS
+	s.UseQUIC = c.UseQUIC
+	s.DoQReconnect = c.DoQReconnect
+	s.UseIPv6 = c.UseIPv6
+	s.ParallelTests = c.ParallelTests
+	s.DoHMethod = c.DoHMethod
+	s.QueryType = c.QueryType
+	s.UncachedTests = c.UncachedTests
+	s.UncachedZone = c.UncachedZone
+	s.CheckAnswers = c.CheckAnswers
+	s.CheckDNSSEC = c.CheckDNSSEC
+	s.ClientSubnet = c.ClientSubnet
+	s.IdentifyResolver = c.IdentifyResolver
+}
+
+// Monitor configures the GUI's monitor mode.
+type Monitor struct {
+	// Schedule is an interval such as "5m" or a cron expression.
+	Schedule string
+	// DesktopAlerts shows alerts as desktop notifications.
+	DesktopAlerts bool
+}
+
+// Retention limits how much history is kept. Zero values mean no limit.
+type Retention struct {
+	// MaxRuns is the number of most recent runs kept.
+	MaxRuns int
+	// MaxAge is how long a run is kept after it started.
+	MaxAge time.Duration
+}
+
+// Apply returns the runs of history, which is oldest first, that r keeps
+// at now.
+func (r Retention) Apply(history []dnsbench.Report, now time.Time) []dnsbench.Report {
+	start := 0
+	if r.MaxRuns > 0 && len(history) > r.MaxRuns {
+		start = len(history) - r.MaxRuns
+	}
+	for r.MaxAge > 0 && start < len(history) && now.Sub(history[start].StartedAt) > r.MaxAge {
+		start++
+	}
+	return history[start:]
+}
@@ -0,0 +1,121 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dns_speed_test/dnsbench"
+)
+
+func useTempConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+	path, err := Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadMissingFileGivesDefaults(t *testing.T) {
+	useTempConfigDir(t)
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Config(), dnsbench.DefaultConfig(); got.TestsPerDomain != want.TestsPerDomain ||
+		got.Timeout != want.Timeout || got.ParallelTests != want.ParallelTests {
+		t.Errorf("Config() = %+v, want defaults %+v", got, want)
+	}
+}
+
+func TestLoadMigratesTestHistory(t *testing.T) {
+	path := useTempConfigDir(t)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := `{"tests_per_domain": 5, "test_history": [[{"Provider": {"Name": "Google"}, "TimeStamp": "2024-05-01T12:00:00Z"}], []]}`
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TestsPerDomain != 5 {
+		t.Errorf("TestsPerDomain = %d, want 5", s.TestsPerDomain)
+	}
+	if len(s.History) != 1 || s.TestHistory != nil {
+		t.Fatalf("History = %+v, TestHistory = %+v; want one migrated run", s.History, s.TestHistory)
+	}
+	if want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC); !s.History[0].StartedAt.Equal(want) ||
+		s.History[0].Results[0].Provider.Name != "Google" {
+		t.Errorf("migrated run = %+v", s.History[0])
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	useTempConfigDir(t)
+	s := New()
+	s.TestsPerDomain = 7
+	s.Retention = Retention{MaxRuns: 10, MaxAge: 24 * time.Hour}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.TestsPerDomain != 7 || loaded.Retention != s.Retention {
+		t.Errorf("loaded %d tests per domain and retention %+v", loaded.TestsPerDomain, loaded.Retention)
+	}
+}
+
+func TestRetentionMaxAge(t *testing.T) {
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	var history []dnsbench.Report
+	for day := 1; day <= 9; day++ {
+		history = append(history, dnsbench.Report{StartedAt: time.Date(2024, 5, day, 0, 0, 0, 0, time.UTC)})
+	}
+	kept := Retention{MaxAge: 7 * 24 * time.Hour}.Apply(history, now)
+	if len(kept) != 7 || kept[0].StartedAt.Day() != 3 {
+		t.Errorf("kept %d runs from day %d, want 7 from day 3", len(kept), kept[0].StartedAt.Day())
+	}
+	if kept := (Retention{MaxRuns: 3, MaxAge: 7 * 24 * time.Hour}).Apply(history, now); len(kept) != 3 {
+		t.Errorf("kept %d runs, want the 3 newest", len(kept))
+	}
+	if kept := (Retention{}).Apply(history, now); len(kept) != len(history) {
+		t.Errorf("zero retention kept %d of %d runs", len(kept), len(history))
+	}
+}
+
+func TestDomainSets(t *testing.T) {
+	path := useTempConfigDir(t)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"tests_per_domain": 3}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Config().Domains) != len(dnsbench.DefaultDomains) {
+		t.Errorf("settings without domain sets test %q, want the defaults", s.Config().Domains)
+	}
+
+	s.DomainSets = append(s.DomainSets, DomainSet{Name: "Our services", Domains: []string{"www.example.com"}})
+	s.DomainSet = "our SERVICES"
+	if got := s.Config().Domains; len(got) != 1 || got[0] != "www.example.com" {
+		t.Errorf("Config().Domains = %q, want the selected set", got)
+	}
+}